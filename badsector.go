@@ -0,0 +1,99 @@
+package gofs
+
+import "syscall"
+
+// AddBadSectors marks sectors of file overlapping range [off, off+n) as unreadable. Like with real disk, read
+// returns bytes before the first bad sector, and read starting at bad sector fails with syscall.EIO. If heal is
+// true, write covering whole bad sector remaps it, so it becomes readable again, otherwise it stays bad.
+// Bad sectors are lost, when file is truncated below them.
+func (f *InMemoryFS) AddBadSectors(name string, off, n int64, heal bool) error {
+	inode, err := f.lockedFile("AddBadSectors", name)
+	if err != nil {
+		return err
+	}
+	if inode.threadSafeMode {
+		defer inode.mu.Unlock()
+	}
+	if off < 0 || n < 0 {
+		return MakeWrappedError("AddBadSectors", name, syscall.EINVAL)
+	}
+	if inode.badSectors == nil {
+		inode.badSectors = map[int64]bool{}
+	}
+	for s := off / sectorSize; s*sectorSize < off+n; s++ {
+		inode.badSectors[s] = heal
+	}
+	return nil
+}
+
+// ClearBadSectors makes all sectors of file readable, see AddBadSectors
+func (f *InMemoryFS) ClearBadSectors(name string) error {
+	inode, err := f.lockedFile("ClearBadSectors", name)
+	if err != nil {
+		return err
+	}
+	if inode.threadSafeMode {
+		defer inode.mu.Unlock()
+	}
+	inode.badSectors = nil
+	return nil
+}
+
+// lockedFile finds regular file and locks its mutex
+func (f *InMemoryFS) lockedFile(op, name string) (*memData, error) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(name, true)
+	if err == nil && inode == nil {
+		err = syscall.ENOENT
+	}
+	if err == nil && !inode.mode.IsRegular() {
+		err = syscall.EINVAL
+	}
+	if err != nil {
+		return nil, MakeWrappedError(op, name, err)
+	}
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+	}
+	return inode, nil
+}
+
+// badOffset returns offset of the first bad sector in range [from, to), or -1 if there is none. Should be
+// called with locked mutex.
+func (m *memData) badOffset(from, to int64) int64 {
+	if len(m.badSectors) == 0 || from >= to {
+		return -1
+	}
+	for s := from / sectorSize; s*sectorSize < to; s++ {
+		if _, ok := m.badSectors[s]; ok {
+			return max(from, s*sectorSize)
+		}
+	}
+	return -1
+}
+
+// healBadSectors remaps healable bad sectors, which are completely rewritten by range [from, to). Should be
+// called with locked mutex.
+func (m *memData) healBadSectors(from, to int64) {
+	if len(m.badSectors) == 0 {
+		return
+	}
+	for s := (from + sectorSize - 1) / sectorSize; (s+1)*sectorSize <= to; s++ {
+		if m.badSectors[s] {
+			delete(m.badSectors, s)
+		}
+	}
+}
+
+// dropBadSectors forgets bad sectors, which are completely beyond size. Should be called with locked mutex.
+func (m *memData) dropBadSectors(size int64) {
+	for s := range m.badSectors {
+		if s*sectorSize >= size {
+			delete(m.badSectors, s)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package gofs
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BitRotMode decides where bit rot happens, see SetBitRot
+type BitRotMode int
+
+const (
+	// BitRotInStorage flips bits of stored content, so corruption is permanent until data is rewritten
+	BitRotInStorage BitRotMode = iota
+	// BitRotOnRead flips bits of returned data only, storage stays intact and every read is corrupted anew
+	BitRotOnRead
+)
+
+type bitRot struct {
+	rate  float64 // flips per MiB per hour
+	mode  BitRotMode
+	since time.Time // content doesn't age before bit rot is enabled
+	rand  *rand.Rand
+	mu    sync.Mutex // guards rand, since files are read concurrently
+}
+
+// WithBitRot enables silent corruption of file content, see SetBitRot
+func WithBitRot(rate float64, mode BitRotMode, seedRand *rand.Rand) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.SetBitRot(rate, mode, seedRand)
+	}
+}
+
+// SetBitRot makes file content silently corrupt over time. On average rate bits per MiB are flipped per hour of
+// fs clock (see WithClock), seedRand makes all random decisions. Content ages since it was written last, or
+// since bit rot was enabled. Rot is applied lazily, when file is accessed, so there is no background goroutine.
+// If seedRand is nil, source with zero seed is used. Non positive rate disables bit rot, content corrupted in
+// storage stays corrupted.
+func (f *InMemoryFS) SetBitRot(rate float64, mode BitRotMode, seedRand *rand.Rand) {
+	if rate <= 0 {
+		f.bitRot.Store(nil)
+		return
+	}
+	if seedRand == nil {
+		seedRand = rand.New(rand.NewSource(0))
+	}
+	f.bitRot.Store(&bitRot{rate: rate, mode: mode, since: f.now(), rand: seedRand})
+}
+
+// pick returns random bit positions to flip in size bytes of content, which aged for given time
+func (br *bitRot) pick(size int, age time.Duration) []int64 {
+	if size == 0 || age <= 0 {
+		return nil
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	n := poisson(br.rand, br.rate*float64(size)/(1<<20)*age.Hours())
+	bits := make([]int64, n)
+	for i := range bits {
+		bits[i] = br.rand.Int63n(int64(size) * 8)
+	}
+	return bits
+}
+
+// poisson samples number of events with given mean. Normal approximation is used for large mean.
+func poisson(r *rand.Rand, mean float64) int {
+	if mean > 30 {
+		return max(0, int(math.Round(mean+math.Sqrt(mean)*r.NormFloat64())))
+	}
+	n := 0
+	for p, limit := r.Float64(), math.Exp(-mean); p > limit; p *= r.Float64() {
+		n++
+	}
+	return n
+}
+
+func flipBit(b []byte, bit int64) {
+	b[bit/8] ^= 1 << (bit % 8)
+}
+
+// age returns time content rotted for since rotTime. Should be called with locked mutex.
+func (m *memData) age(br *bitRot, now time.Time) time.Duration {
+	from := br.since
+	if m.rotTime.After(from) {
+		from = m.rotTime
+	}
+	return now.Sub(from)
+}
+
+// rotStored flips bits of stored content for the time passed since the last rot. Clean content on disk rots
+// as well, so Crash doesn't repair it. Should be called with locked mutex.
+func (m *memData) rotStored(br *bitRot) {
+	now := m.fs.now()
+	for _, bit := range br.pick(len(m.buff), m.age(br, now)) {
+		off := bit / 8
+		if off < int64(len(m.durable)) && m.durable[off] == m.buff[off] {
+			flipBit(m.durable, bit)
+		}
+		flipBit(m.buff, bit)
+	}
+	m.rotTime = now
+}
+
+// rotRead corrupts bytes read from content according to its age. Should be called with locked mutex.
+func (m *memData) rotRead(br *bitRot, b []byte) {
+	for _, bit := range br.pick(len(b), m.age(br, m.fs.now())) {
+		flipBit(b, bit)
+	}
+}
+
+// rotBeforeChange applies pending rot of stored content and restarts its aging, since it's about to be
+// rewritten. Should be called with locked mutex.
+func (m *memData) rotBeforeChange() {
+	br := m.fs.bitRot.Load()
+	if br == nil {
+		return
+	}
+	if br.mode == BitRotInStorage {
+		m.rotStored(br)
+		return
+	}
+	m.rotTime = m.fs.now()
+}
@@ -0,0 +1,193 @@
+package gofs
+
+import (
+	"math"
+	"syscall"
+
+	"github.com/myxo/gofs/internal/util"
+)
+
+// WithCapacity limits total size of file content and number of inodes (files, directories, symlinks and special
+// files, including root directory). Zero means no limit, which is the default. See SetCapacity.
+func WithCapacity(bytes, inodes int64) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.SetCapacity(bytes, inodes)
+	}
+}
+
+// SetCapacity changes fs limits, see WithCapacity. Limits may be set below current usage, in that case fs is
+// full until enough space is freed. Once limit is reached, writes, truncates and file creation fail with
+// syscall.ENOSPC. File size is charged byte by byte, holes and block rounding are not emulated.
+func (f *InMemoryFS) SetCapacity(bytes, inodes int64) {
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	f.byteCapacity = max(bytes, 0)
+	f.inodeCapacity = max(inodes, 0)
+}
+
+// Statfs reports capacity and usage of fs. Path is only checked for existence, since
+// all files share one capacity.
+func (f *InMemoryFS) Statfs(path string) (FsStat, error) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(path, true)
+	if err == nil && inode == nil {
+		err = syscall.ENOENT
+	}
+	if err != nil {
+		return FsStat{}, MakeWrappedError("statfs", path, err)
+	}
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	totalBytes, freeBytes := capacityStat(f.byteCapacity, f.usedBytes)
+	totalInodes, freeInodes := capacityStat(f.inodeCapacity, f.usedInodes)
+	return FsStat{
+		TotalBytes:  totalBytes,
+		FreeBytes:   freeBytes,
+		TotalInodes: totalInodes,
+		FreeInodes:  freeInodes,
+	}, nil
+}
+
+func capacityStat(limit, used int64) (total, free uint64) {
+	if limit == 0 {
+		limit = math.MaxInt64
+	}
+	return uint64(limit), uint64(max(limit-used, 0))
+}
+
+// available returns how much of n fits under limit, zero limit means unlimited
+func available(n, limit, used int64) int64 {
+	if limit == 0 {
+		return n
+	}
+	return max(min(n, limit-used), 0)
+}
+
+// reserveBytes charges up to n bytes to fs and quotas of inode. It returns number of bytes taken,
+// and error explaining why it's less than n. Like in kernel, quota is checked before free space.
+func (m *memData) reserveBytes(n int64) (int64, error) {
+	f := m.fs
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+
+	var err error
+	granted := n
+	for q := m.quota; q != nil; q = q.parent {
+		if g := available(granted, q.bytes, q.usedBytes); g < granted {
+			granted, err = g, syscall.EDQUOT
+		}
+	}
+	if g := available(granted, f.byteCapacity, f.usedBytes); g < granted {
+		granted, err = g, syscall.ENOSPC
+	}
+	m.chargeBytes(granted)
+	return granted, err
+}
+
+// chargeBytes adds n (possibly negative) bytes to usage of fs and quotas. Should be called with locked capMu.
+func (m *memData) chargeBytes(n int64) {
+	m.charged += n
+	m.fs.usedBytes += n
+	for q := m.quota; q != nil; q = q.parent {
+		q.usedBytes += n
+	}
+}
+
+// releaseBytes returns n bytes previously taken with reserveBytes
+func (m *memData) releaseBytes(n int64) {
+	m.fs.capMu.Lock()
+	defer m.fs.capMu.Unlock()
+	m.chargeBytes(-n)
+}
+
+// allocInode charges one inode to fs and quotas of dir, and returns quota new entry belongs to
+func (f *InMemoryFS) allocInode(dir *memData) (*quota, error) {
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+
+	q := dir.childQuota()
+	for cur := q; cur != nil; cur = cur.parent {
+		if available(1, cur.inodes, cur.usedInodes) == 0 {
+			return nil, syscall.EDQUOT
+		}
+	}
+	if available(1, f.inodeCapacity, f.usedInodes) == 0 {
+		return nil, syscall.ENOSPC
+	}
+	f.usedInodes++
+	for cur := q; cur != nil; cur = cur.parent {
+		cur.usedInodes++
+	}
+	return q, nil
+}
+
+// freeInode returns inode and its content space to fs and quotas
+func (m *memData) freeInode() {
+	m.fs.capMu.Lock()
+	defer m.fs.capMu.Unlock()
+	m.chargeBytes(-m.charged)
+	m.fs.usedInodes--
+	for q := m.quota; q != nil; q = q.parent {
+		q.usedInodes--
+	}
+}
+
+// detachSpace releases space of removed inode, which is kept only to undo its removal on Crash. Content, which
+// is not durable yet, is dropped, since nobody can read it anymore. Should be called with locked mutex.
+func (m *memData) detachSpace() {
+	if m.spaceDetached {
+		return
+	}
+	m.spaceDetached = true
+	m.freeInode()
+	m.buff = nil
+	m.dirtyPages = m.dirtyPages[:0]
+}
+
+// attachSpace charges again inode, which removal is undone, with its durable content. Like on Crash, limits are
+// not checked, since the space was taken before. Should be called with locked mutex.
+func (m *memData) attachSpace() {
+	if !m.spaceDetached {
+		return
+	}
+	m.spaceDetached = false
+	m.buff = append(m.buff[:0], m.durable...)
+	m.minSize = int64(len(m.buff))
+
+	m.fs.capMu.Lock()
+	defer m.fs.capMu.Unlock()
+	m.fs.usedInodes++
+	for q := m.quota; q != nil; q = q.parent {
+		q.usedInodes++
+	}
+	m.chargeBytes(int64(len(m.buff)))
+}
+
+// resize truncates or extends file content with zeros. Extension is all or nothing, like fallocate.
+// Should be called with locked mutex.
+func (m *memData) resize(size int64) error {
+	m.rotBeforeChange()
+	grow := size - int64(len(m.buff))
+	if grow > 0 {
+		if granted, err := m.reserveBytes(grow); err != nil {
+			m.releaseBytes(granted)
+			return err
+		}
+	} else {
+		m.releaseBytes(-grow)
+	}
+	m.buff = util.ResizeSlice(m.buff, int(size))
+	clear(m.buff[len(m.buff):cap(m.buff)])
+	m.minSize = min(m.minSize, size)
+	m.dropBadSectors(size)
+	if m.fs.uid != 0 {
+		m.dropPrivs()
+	}
+	m.mtime = m.fs.now()
+	m.ctime = m.mtime
+	return nil
+}
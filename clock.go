@@ -0,0 +1,60 @@
+package gofs
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time for InMemoryFS timestamps
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a manually driven Clock. Time changes only with Advance or Set calls, so
+// tests that depend on file timestamps become deterministic. It's safe for concurrent use.
+type FakeClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+var _ Clock = &FakeClock{}
+
+// NewFakeClock creates clock stopped at t
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set changes current time to t, it may be used to move clock backwards
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// advanceTo moves clock forward to t, if it's later than current time
+func (c *FakeClock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
@@ -0,0 +1,138 @@
+package gofs
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+
+	"github.com/myxo/gofs/internal/util"
+)
+
+// sectorSize is a unit of write atomicity on power loss
+const sectorSize = 512
+
+// sync makes file content durable. Should be called with locked fs mutex and mutex.
+func (m *memData) sync() {
+	if m.fs.trackDirtyPages {
+		keep := min(int64(len(m.durable)), m.minSize)
+		m.durable = util.ResizeSlice(m.durable[:keep], len(m.buff))
+		clear(m.durable[keep:])
+		for _, dirty := range m.dirtyPages {
+			from, to := min(dirty.from, int64(len(m.buff))), min(dirty.to, int64(len(m.buff)))
+			m.persist(from, to)
+		}
+		m.minSize = int64(len(m.buff))
+	}
+	m.dirtyPages = m.dirtyPages[:0]
+}
+
+// Crash simulates power loss. All open files become invalid, removed files are freed. Content written since
+// the last Sync is lost, or some of its sectors survive, which is decided with seedRand. Not synced size change
+// is either kept or lost as a whole. Creations, removals and renames not followed by Sync of their directory
+// are undone, except some prefix of them in order they were made. To have something to lose, TrackDirtyPages
+// should be called before writes, otherwise all content is considered durable.
+func (f *InMemoryFS) Crash(seedRand *rand.Rand) {
+	f.CrashWith(seedRand.Intn)
+}
+
+// CrashWith is Crash with choose making all decisions, it should return number in [0, n). Decisions are
+// made in the same order for the same fs state, so all crash outcomes may be enumerated, see crashtest package.
+func (f *InMemoryFS) CrashWith(choose func(n int) int) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	f.closeAll()
+	if !f.trackDirtyPages {
+		return
+	}
+	f.crashJournal(choose)
+	var files []*memData
+	f.forEachInode(func(inode *memData) {
+		if inode.mode.IsRegular() {
+			files = append(files, inode)
+		}
+	})
+	// map iteration order is random, but decisions should be reproducible
+	slices.SortFunc(files, func(a, b *memData) int {
+		return cmp.Compare(a.ino, b.ino)
+	})
+	for _, inode := range files {
+		inode.crash(choose)
+	}
+}
+
+// SetMutationHook sets function called before every operation, which may change content or names of files
+// (but not their metadata), even if it fails then. Op is name of the method and name is the file path. Hook
+// may panic to stop the workload at that point, e.g. to Crash there, fs stays consistent. Hook should not
+// use fs, nil removes it. It should be set before fs is used from multiple goroutines.
+func (f *InMemoryFS) SetMutationHook(hook func(op, name string)) {
+	f.mutationHook = hook
+}
+
+// mutating calls mutation hook, if any
+func (f *InMemoryFS) mutating(op, name string) {
+	if f.mutationHook != nil {
+		f.mutationHook(op, name)
+	}
+}
+
+// closeAll closes all open files, like it happens when process dies
+func (f *InMemoryFS) closeAll() {
+	f.filesMu.Lock()
+	files := make([]*FakeFile, 0, len(f.openFiles))
+	for fp := range f.openFiles {
+		files = append(files, fp)
+	}
+	f.filesMu.Unlock()
+	for _, fp := range files {
+		_ = fp.Close()
+	}
+}
+
+// crash replaces file content with what could be on disk after power loss
+func (m *memData) crash(choose func(n int) int) {
+	if m.threadSafeMode {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+
+	durableSize, size := int64(len(m.durable)), int64(len(m.buff))
+	var content []byte
+	if (size != durableSize || m.minSize < durableSize) && choose(2) == 1 {
+		// size change reached the disk, but not necessarily the data
+		keep := min(durableSize, m.minSize, size)
+		content = make([]byte, size)
+		copy(content, m.durable[:keep])
+	} else {
+		content = slices.Clone(m.durable)
+	}
+
+	var sectors []int64
+	for _, dirty := range m.dirtyPages {
+		for s := dirty.from / sectorSize; s*sectorSize < dirty.to; s++ {
+			sectors = append(sectors, s)
+		}
+	}
+	slices.Sort(sectors)
+	for _, s := range slices.Compact(sectors) {
+		from, to := s*sectorSize, min((s+1)*sectorSize, int64(len(content)), size)
+		if from >= to {
+			continue
+		}
+		if choose(2) == 1 {
+			copy(content[from:to], m.buff[from:to])
+		}
+	}
+
+	m.fs.capMu.Lock()
+	m.chargeBytes(int64(len(content)) - size)
+	m.fs.capMu.Unlock()
+	m.buff = util.ResizeSlice(m.buff, len(content))
+	copy(m.buff, content)
+	clear(m.buff[len(m.buff):cap(m.buff)])
+	m.durable = content
+	m.minSize = int64(len(content))
+	m.dirtyPages = m.dirtyPages[:0]
+}
@@ -0,0 +1,227 @@
+// Package crashtest checks that a workload running on gofs.InMemoryFS survives power loss at any moment.
+// Like ALICE and CrashMonkey do for C programs, it records mutating operations of the workload, then replays
+// it crashing before each of them, and checks every outcome of the crash permitted by the fs model: lost or
+// kept writes and namespace changes, which were not synced.
+package crashtest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/myxo/gofs"
+)
+
+// Workload is the code under test. It's replayed many times and should do the same operations each time,
+// so it should not depend on time, randomness or anything outside of fs. It should not recover panics.
+type Workload func(fs *gofs.InMemoryFS) error
+
+// Check recovers fs after crash, e.g. opens database on it, and verifies invariants.
+type Check func(fs *gofs.InMemoryFS) error
+
+// Options of Run, zero value is usable
+type Options struct {
+	// NewFS creates fs for every replay, each time with the same content, which is considered durable.
+	// It should not call TrackDirtyPages. Empty fs is used by default.
+	NewFS func() *gofs.InMemoryFS
+	// MaxStates limits number of crash outcomes checked at each point, default is 1000. Outcomes are
+	// enumerated depth first, so decisions made last are explored better, if the limit is hit.
+	MaxStates int
+}
+
+// Point is the moment of crash, before operation Index of workload. For crash after the whole
+// workload Op and Name are empty.
+type Point struct {
+	Index int
+	Op    string // method name, e.g. "Write" or "Sync"
+	Name  string // file path
+}
+
+func (p Point) String() string {
+	if p.Op == "" {
+		return "at the end of workload"
+	}
+	return fmt.Sprintf("before %s %s (operation %d)", p.Op, p.Name, p.Index)
+}
+
+// Failure is returned by Run, if check failed. It can be examined with Reproduce.
+type Failure struct {
+	Point   Point
+	Choices []int // crash decisions, see gofs.InMemoryFS.CrashWith
+	Err     error
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("crashtest: check failed after crash %s with choices %v: %v", f.Point, f.Choices, f.Err)
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Report describes what was checked
+type Report struct {
+	Points    []Point // recorded operations
+	States    int     // number of checked crash outcomes
+	Truncated int     // number of crash points, where MaxStates was reached
+}
+
+var errNotDeterministic = errors.New("crashtest: workload is not deterministic")
+
+// crashPoint is panic value used to stop workload
+type crashPoint struct{}
+
+// Run records workload, then crashes its replays at every point and calls check for every crash outcome.
+// It returns *Failure for the first failed check.
+func Run(workload Workload, check Check, opts Options) (Report, error) {
+	r, err := record(workload, opts)
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{Points: r.points}
+	maxStates := opts.MaxStates
+	if maxStates <= 0 {
+		maxStates = 1000
+	}
+	for i := 0; i <= len(r.points); i++ {
+		ex := &explorer{}
+		for states := 0; ; states++ {
+			if states == maxStates {
+				report.Truncated++
+				break
+			}
+			fs, err := r.replay(i, ex.choose)
+			if err != nil {
+				return report, err
+			}
+			report.States++
+			if err := check(fs); err != nil {
+				return report, &Failure{Point: r.point(i), Choices: slices.Clone(ex.choices), Err: err}
+			}
+			if !ex.next() {
+				break
+			}
+		}
+	}
+	return report, nil
+}
+
+// Reproduce returns fs in state after crash described by failure, so it could be examined
+func Reproduce(workload Workload, opts Options, failure *Failure) (*gofs.InMemoryFS, error) {
+	r, err := record(workload, opts)
+	if err != nil {
+		return nil, err
+	}
+	if failure.Point.Index > len(r.points) {
+		return nil, errNotDeterministic
+	}
+	choices := failure.Choices
+	return r.replay(failure.Point.Index, func(n int) int {
+		if len(choices) == 0 {
+			return 0
+		}
+		c := min(choices[0], n-1)
+		choices = choices[1:]
+		return c
+	})
+}
+
+type runner struct {
+	workload Workload
+	newFS    func() *gofs.InMemoryFS
+	points   []Point
+}
+
+// record runs workload once to learn its operations
+func record(workload Workload, opts Options) (*runner, error) {
+	r := &runner{workload: workload, newFS: opts.NewFS}
+	if r.newFS == nil {
+		r.newFS = func() *gofs.InMemoryFS {
+			return gofs.NewMemoryFs()
+		}
+	}
+	fs := r.newFS()
+	fs.TrackDirtyPages()
+	fs.SetMutationHook(func(op, name string) {
+		r.points = append(r.points, Point{Index: len(r.points), Op: op, Name: name})
+	})
+	if err := workload(fs); err != nil {
+		return nil, fmt.Errorf("crashtest: workload failed: %w", err)
+	}
+	return r, nil
+}
+
+func (r *runner) point(i int) Point {
+	if i < len(r.points) {
+		return r.points[i]
+	}
+	return Point{Index: i}
+}
+
+// replay runs workload until operation index and crashes fs there, with choose making decisions
+func (r *runner) replay(index int, choose func(n int) int) (*gofs.InMemoryFS, error) {
+	fs := r.newFS()
+	fs.TrackDirtyPages()
+	done := 0
+	deterministic := true
+	fs.SetMutationHook(func(op, name string) {
+		if done >= index {
+			// also stops operations in deferred calls of workload
+			panic(crashPoint{})
+		}
+		if done == len(r.points) || r.points[done].Op != op || r.points[done].Name != name {
+			deterministic = false
+			panic(crashPoint{})
+		}
+		done++
+	})
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				if _, ok := p.(crashPoint); !ok {
+					panic(p)
+				}
+			}
+		}()
+		_ = r.workload(fs)
+	}()
+	fs.SetMutationHook(nil)
+	if !deterministic || done < index {
+		return nil, errNotDeterministic
+	}
+	fs.CrashWith(choose)
+	return fs, nil
+}
+
+// explorer enumerates crash decisions depth first. Replay with the same decisions should ask for the same
+// choices, so each run follows decisions made before and takes zero in new choices.
+type explorer struct {
+	choices []int
+	arity   []int
+	pos     int
+}
+
+func (e *explorer) choose(n int) int {
+	if e.pos == len(e.choices) {
+		e.choices = append(e.choices, 0)
+		e.arity = append(e.arity, n)
+	}
+	c := min(e.choices[e.pos], n-1)
+	e.pos++
+	return c
+}
+
+// next moves to the next outcome, it returns false if all of them were seen
+func (e *explorer) next() bool {
+	e.choices, e.arity = e.choices[:e.pos], e.arity[:e.pos]
+	e.pos = 0
+	for len(e.choices) > 0 {
+		last := len(e.choices) - 1
+		if e.choices[last]+1 < e.arity[last] {
+			e.choices[last]++
+			return true
+		}
+		e.choices, e.arity = e.choices[:last], e.arity[:last]
+	}
+	return false
+}
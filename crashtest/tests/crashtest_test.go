@@ -0,0 +1,127 @@
+package crashtest_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/myxo/gofs/crashtest"
+	"github.com/stretchr/testify/require"
+)
+
+func withConfig() *gofs.InMemoryFS {
+	fs := gofs.NewMemoryFs()
+	if err := fs.WriteFile("/config", []byte("old"), 0666); err != nil {
+		panic(err)
+	}
+	return fs
+}
+
+// save replaces config with the usual write, fsync, rename, fsync directory sequence
+func save(fsyncFile bool) crashtest.Workload {
+	return func(fs *gofs.InMemoryFS) error {
+		fp, err := fs.Create("/config.tmp")
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		if _, err := fp.WriteString("new"); err != nil {
+			return err
+		}
+		if fsyncFile {
+			if err := fp.Sync(); err != nil {
+				return err
+			}
+		}
+		if err := fs.Rename("/config.tmp", "/config"); err != nil {
+			return err
+		}
+		dir, err := fs.Open("/")
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		return dir.Sync()
+	}
+}
+
+func checkConfig(fs *gofs.InMemoryFS) error {
+	data, err := fs.ReadFile("/config")
+	if err != nil {
+		return err
+	}
+	if string(data) != "old" && string(data) != "new" {
+		return fmt.Errorf("config is corrupted: %q", data)
+	}
+	return nil
+}
+
+func checkNothing(fs *gofs.InMemoryFS) error {
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	t.Run("atomic save", func(t *testing.T) {
+		report, err := crashtest.Run(save(true), checkConfig, crashtest.Options{NewFS: withConfig})
+		require.NoError(t, err)
+		var ops []string
+		for _, p := range report.Points {
+			ops = append(ops, p.Op)
+		}
+		require.Equal(t, []string{"OpenFile", "Write", "Sync", "Rename", "Sync"}, ops)
+		require.Greater(t, report.States, len(report.Points)+1)
+		require.Zero(t, report.Truncated)
+
+		// check is called before any operation as well
+		_, err = crashtest.Run(save(true), func(fs *gofs.InMemoryFS) error {
+			data, err := fs.ReadFile("/config")
+			if err == nil && string(data) != "new" {
+				err = errors.New("old config")
+			}
+			return err
+		}, crashtest.Options{NewFS: withConfig})
+		var failure *crashtest.Failure
+		require.ErrorAs(t, err, &failure)
+		require.Equal(t, 0, failure.Point.Index)
+	})
+
+	t.Run("missing fsync", func(t *testing.T) {
+		_, err := crashtest.Run(save(false), checkConfig, crashtest.Options{NewFS: withConfig})
+		var failure *crashtest.Failure
+		require.ErrorAs(t, err, &failure)
+		require.Equal(t, "Sync", failure.Point.Op)
+		require.ErrorContains(t, err, "config is corrupted")
+
+		fs, err := crashtest.Reproduce(save(false), crashtest.Options{NewFS: withConfig}, failure)
+		require.NoError(t, err)
+		require.Equal(t, failure.Err, checkConfig(fs))
+	})
+
+	t.Run("max states", func(t *testing.T) {
+		workload := func(fs *gofs.InMemoryFS) error {
+			return fs.WriteFile("/data", make([]byte, 64*1024), 0666)
+		}
+		report, err := crashtest.Run(workload, checkNothing, crashtest.Options{MaxStates: 10})
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Truncated)
+		require.LessOrEqual(t, report.States, 10*(len(report.Points)+1))
+	})
+
+	t.Run("not deterministic", func(t *testing.T) {
+		calls := 0
+		workload := func(fs *gofs.InMemoryFS) error {
+			calls++
+			return fs.Mkdir(fmt.Sprintf("/dir%d", calls), 0777)
+		}
+		_, err := crashtest.Run(workload, checkNothing, crashtest.Options{})
+		require.ErrorContains(t, err, "not deterministic")
+	})
+
+	t.Run("workload error", func(t *testing.T) {
+		_, err := crashtest.Run(func(fs *gofs.InMemoryFS) error {
+			return fs.Remove("/missing")
+		}, checkNothing, crashtest.Options{})
+		require.ErrorContains(t, err, "workload failed")
+	})
+}
@@ -0,0 +1,103 @@
+package gofs
+
+import (
+	"os"
+	"slices"
+	"syscall"
+)
+
+const (
+	permRead    os.FileMode = 4
+	permWrite   os.FileMode = 2
+	permExecute os.FileMode = 1
+)
+
+// hasPerm checks if emulated process has want (combination of permRead, permWrite, permExecute)
+// access to inode. If credentials were not configured explicitly any of owner, group or
+// other bits is enough for each wanted permission.
+func (f *InMemoryFS) hasPerm(inode *memData, want os.FileMode) bool {
+	perm := inode.mode.Perm()
+	if !f.checkCredentials {
+		for _, p := range []os.FileMode{permRead, permWrite, permExecute} {
+			if want&p != 0 && perm&(p*0111) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if f.uid == 0 {
+		// root can read and write anything, but can execute only if somebody can
+		if want&permExecute == 0 || inode.isDir() {
+			return true
+		}
+		return perm&0111 != 0
+	}
+
+	var bits os.FileMode
+	switch {
+	case f.uid == inode.uid:
+		bits = perm >> 6
+	case f.inGroup(inode.gid):
+		bits = perm >> 3
+	default:
+		bits = perm
+	}
+	return bits&want == want
+}
+
+func (f *InMemoryFS) inGroup(gid int) bool {
+	return f.gid == gid || slices.Contains(f.groups, gid)
+}
+
+// isOwner reports if emulated process may change inode attributes (mode, times)
+func (f *InMemoryFS) isOwner(inode *memData) bool {
+	return !f.checkCredentials || f.uid == 0 || f.uid == inode.uid
+}
+
+// canChown mimic kernel rules: only root can change owner, and owner can change group only
+// to one of his groups
+func (f *InMemoryFS) canChown(inode *memData, uid, gid int) bool {
+	if !f.checkCredentials || f.uid == 0 {
+		return true
+	}
+	if uid != -1 && (f.uid != inode.uid || uid != inode.uid) {
+		return false
+	}
+	if gid != -1 && (f.uid != inode.uid || (gid != inode.gid && !f.inGroup(gid))) {
+		return false
+	}
+	return true
+}
+
+// canModifyDir reports if emulated process may create or remove entries in directory
+func (f *InMemoryFS) canModifyDir(dir *memData) bool {
+	return f.hasPerm(dir, permWrite|permExecute)
+}
+
+// mayDelete checks if emulated process may remove or rename entry of directory dir, like kernel may_delete
+func (f *InMemoryFS) mayDelete(dir, inode *memData) error {
+	if !f.canModifyDir(dir) {
+		return os.ErrPermission
+	}
+	if !f.stickyAllows(dir, inode) {
+		return syscall.EPERM
+	}
+	return nil
+}
+
+// stickyAllows mimic kernel rule for sticky directories: entry may be removed or renamed only by owner of the
+// entry, owner of directory or root
+func (f *InMemoryFS) stickyAllows(dir, inode *memData) bool {
+	if dir.mode&os.ModeSticky == 0 || !f.checkCredentials || f.uid == 0 {
+		return true
+	}
+	return f.uid == inode.uid || f.uid == dir.uid
+}
+
+// newOwner returns uid and gid for new entry in dir. Like in linux, entries of setgid directory inherit its group.
+func (f *InMemoryFS) newOwner(dir *memData) (int, int) {
+	if dir.mode&os.ModeSetgid != 0 {
+		return f.uid, dir.gid
+	}
+	return f.uid, f.gid
+}
@@ -0,0 +1,517 @@
+package gofs
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultRule describes which operations FaultFS fails and with what error. Rule triggers only if all of the
+// set conditions hold.
+type FaultRule struct {
+	// Op is a name of FS or File method, e.g. "OpenFile", "Write", "Sync", "Rename". FS and File methods with
+	// the same name (Chmod, Chown, ReadDir, Truncate) share it, WriteString and ReadFrom count as "Write".
+	// Empty Op matches any operation.
+	Op string
+	// Path is a filepath.Match pattern for the path operation is called with. File operations use the name
+	// file was opened with. Rename, Link and Symlink match if any of two paths does. Empty Path matches any.
+	Path string
+	// Nth makes rule trigger only on nth matching call, counting from 1
+	Nth int
+	// Probability makes rule trigger randomly, using FaultFS random source
+	Probability float64
+	// OffsetFrom and OffsetTo make rule match only reads and writes touching bytes in [OffsetFrom, OffsetTo).
+	// Read and Write use current file offset. Zero OffsetTo means no range.
+	OffsetFrom int64
+	OffsetTo   int64
+	// Err is injected error, syscall.EIO if nil. It's wrapped into *os.PathError (or *os.LinkError), except
+	// io.EOF.
+	Err error
+}
+
+// FaultFS wraps any FS, including OsFs, and fails its and its files operations according to rules. Failed
+// operation is not passed to wrapped fs, except Close, which closes file anyway like linux does.
+// Rules may be added and removed at any time, FaultFS is safe for concurrent use.
+type FaultFS struct {
+	fs     FS
+	mu     sync.Mutex
+	rand   *rand.Rand
+	rules  []*faultRuleState
+	lastID int
+}
+
+var _ FS = &FaultFS{}
+
+type faultRuleState struct {
+	id    int
+	rule  FaultRule
+	calls int // number of matched calls
+}
+
+// NewFaultFS creates fault injection wrapper over fs. seedRand is used for probabilistic rules, if it's nil,
+// source with zero seed is used.
+func NewFaultFS(fs FS, seedRand *rand.Rand) *FaultFS {
+	if seedRand == nil {
+		seedRand = rand.New(rand.NewSource(0))
+	}
+	return &FaultFS{fs: fs, rand: seedRand}
+}
+
+// AddRule adds rule and returns its id for RemoveRule. If several rules trigger, error of the earliest
+// added one is returned.
+func (f *FaultFS) AddRule(rule FaultRule) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastID++
+	f.rules = append(f.rules, &faultRuleState{id: f.lastID, rule: rule})
+	return f.lastID
+}
+
+// RemoveRule removes rule added with AddRule, unknown ids are ignored
+func (f *FaultFS) RemoveRule(id int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, st := range f.rules {
+		if st.id == id {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return
+		}
+	}
+}
+
+// ClearRules removes all rules
+func (f *FaultFS) ClearRules() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = nil
+}
+
+// ioRange describes bytes touched by read or write. Read and Write touch bytes from current position of
+// file, which is asked only if some rule needs it.
+type ioRange struct {
+	off    int64
+	n      int64
+	cursor *File // if not nil, off is its current position
+}
+
+func (r ioRange) touches(from, to int64) bool {
+	if r.n <= 0 {
+		return false
+	}
+	off := r.off
+	if r.cursor != nil {
+		pos, err := r.cursor.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return false
+		}
+		off = pos
+	}
+	return off < to && off+r.n > from
+}
+
+func (r *FaultRule) matches(op string, rng ioRange, paths []string) bool {
+	if r.Op != "" && r.Op != op {
+		return false
+	}
+	if r.OffsetTo != 0 && !rng.touches(r.OffsetFrom, r.OffsetTo) {
+		return false
+	}
+	if r.Path == "" {
+		return true
+	}
+	for _, path := range paths {
+		if ok, _ := filepath.Match(r.Path, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fault returns not wrapped error to inject into operation, or nil
+func (f *FaultFS) fault(op string, rng ioRange, paths ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	for _, st := range f.rules {
+		if !st.rule.matches(op, rng, paths) {
+			continue
+		}
+		// every rule counts its calls, even if earlier one already triggered
+		st.calls++
+		if st.rule.Nth > 0 && st.calls != st.rule.Nth {
+			continue
+		}
+		if st.rule.Probability > 0 && f.rand.Float64() >= st.rule.Probability {
+			continue
+		}
+		if err == nil {
+			err = st.rule.Err
+			if err == nil {
+				err = syscall.EIO
+			}
+		}
+	}
+	return err
+}
+
+func (f *FaultFS) pathFault(op, path string) error {
+	return MakeWrappedError(op, path, f.fault(op, ioRange{}, path))
+}
+
+func (f *FaultFS) linkFault(op, oldname, newname string) error {
+	if err := f.fault(op, ioRange{}, oldname, newname); err != nil {
+		return &os.LinkError{Op: op, Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (f *FaultFS) wrapFile(fp *File, err error) (*File, error) {
+	if err != nil {
+		return fp, err
+	}
+	return &File{wrapped: &faultFile{fs: f, file: fp}}, nil
+}
+
+func (f *FaultFS) Create(name string) (*File, error) {
+	if err := f.pathFault("Create", name); err != nil {
+		return nil, err
+	}
+	return f.wrapFile(f.fs.Create(name))
+}
+
+func (f *FaultFS) CreateTemp(dir, pattern string) (*File, error) {
+	if err := f.pathFault("CreateTemp", dir); err != nil {
+		return nil, err
+	}
+	return f.wrapFile(f.fs.CreateTemp(dir, pattern))
+}
+
+func (f *FaultFS) Open(name string) (*File, error) {
+	if err := f.pathFault("Open", name); err != nil {
+		return nil, err
+	}
+	return f.wrapFile(f.fs.Open(name))
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	if err := f.pathFault("OpenFile", name); err != nil {
+		return nil, err
+	}
+	return f.wrapFile(f.fs.OpenFile(name, flag, perm))
+}
+
+func (f *FaultFS) Chdir(dir string) error {
+	if err := f.pathFault("Chdir", dir); err != nil {
+		return err
+	}
+	return f.fs.Chdir(dir)
+}
+
+func (f *FaultFS) Chmod(name string, mode os.FileMode) error {
+	if err := f.pathFault("Chmod", name); err != nil {
+		return err
+	}
+	return f.fs.Chmod(name, mode)
+}
+
+func (f *FaultFS) Chown(name string, uid, gid int) error {
+	if err := f.pathFault("Chown", name); err != nil {
+		return err
+	}
+	return f.fs.Chown(name, uid, gid)
+}
+
+func (f *FaultFS) Lchown(name string, uid, gid int) error {
+	if err := f.pathFault("Lchown", name); err != nil {
+		return err
+	}
+	return f.fs.Lchown(name, uid, gid)
+}
+
+func (f *FaultFS) Mkdir(name string, perm os.FileMode) error {
+	if err := f.pathFault("Mkdir", name); err != nil {
+		return err
+	}
+	return f.fs.Mkdir(name, perm)
+}
+
+func (f *FaultFS) MkdirAll(path string, perm os.FileMode) error {
+	if err := f.pathFault("MkdirAll", path); err != nil {
+		return err
+	}
+	return f.fs.MkdirAll(path, perm)
+}
+
+func (f *FaultFS) MkdirTemp(dir, pattern string) (string, error) {
+	if err := f.pathFault("MkdirTemp", dir); err != nil {
+		return "", err
+	}
+	return f.fs.MkdirTemp(dir, pattern)
+}
+
+func (f *FaultFS) TempDir() string {
+	return f.fs.TempDir()
+}
+
+func (f *FaultFS) ReadFile(name string) ([]byte, error) {
+	if err := f.pathFault("ReadFile", name); err != nil {
+		return nil, err
+	}
+	return f.fs.ReadFile(name)
+}
+
+func (f *FaultFS) Readlink(name string) (string, error) {
+	if err := f.pathFault("Readlink", name); err != nil {
+		return "", err
+	}
+	return f.fs.Readlink(name)
+}
+
+func (f *FaultFS) ReadDir(name string) ([]os.DirEntry, error) {
+	if err := f.pathFault("ReadDir", name); err != nil {
+		return nil, err
+	}
+	return f.fs.ReadDir(name)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.pathFault("Remove", name); err != nil {
+		return err
+	}
+	return f.fs.Remove(name)
+}
+
+func (f *FaultFS) RemoveAll(path string) error {
+	if err := f.pathFault("RemoveAll", path); err != nil {
+		return err
+	}
+	return f.fs.RemoveAll(path)
+}
+
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if err := f.linkFault("Rename", oldpath, newpath); err != nil {
+		return err
+	}
+	return f.fs.Rename(oldpath, newpath)
+}
+
+func (f *FaultFS) Truncate(name string, size int64) error {
+	if err := f.pathFault("Truncate", name); err != nil {
+		return err
+	}
+	return f.fs.Truncate(name, size)
+}
+
+func (f *FaultFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := f.pathFault("WriteFile", name); err != nil {
+		return err
+	}
+	return f.fs.WriteFile(name, data, perm)
+}
+
+func (f *FaultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.pathFault("Stat", name); err != nil {
+		return nil, err
+	}
+	return f.fs.Stat(name)
+}
+
+func (f *FaultFS) Lstat(name string) (os.FileInfo, error) {
+	if err := f.pathFault("Lstat", name); err != nil {
+		return nil, err
+	}
+	return f.fs.Lstat(name)
+}
+
+func (f *FaultFS) Symlink(oldname, newname string) error {
+	if err := f.linkFault("Symlink", oldname, newname); err != nil {
+		return err
+	}
+	return f.fs.Symlink(oldname, newname)
+}
+
+func (f *FaultFS) Link(oldname, newname string) error {
+	if err := f.linkFault("Link", oldname, newname); err != nil {
+		return err
+	}
+	return f.fs.Link(oldname, newname)
+}
+
+func (f *FaultFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := f.pathFault("Chtimes", name); err != nil {
+		return err
+	}
+	return f.fs.Chtimes(name, atime, mtime)
+}
+
+func (f *FaultFS) Statfs(path string) (FsStat, error) {
+	if err := f.pathFault("Statfs", path); err != nil {
+		return FsStat{}, err
+	}
+	return f.fs.Statfs(path)
+}
+
+// faultFile is a file opened with FaultFS
+type faultFile struct {
+	fs   *FaultFS
+	file *File
+}
+
+func (f *faultFile) fault(op string, rng ioRange) error {
+	name := f.file.Name()
+	return MakeWrappedError(op, name, f.fs.fault(op, rng, name))
+}
+
+func (f *faultFile) Fd() uintptr {
+	return f.file.Fd()
+}
+
+func (f *faultFile) Chdir() error {
+	if err := f.fault("Chdir", ioRange{}); err != nil {
+		return err
+	}
+	return f.file.Chdir()
+}
+
+func (f *faultFile) Chmod(mode os.FileMode) error {
+	if err := f.fault("Chmod", ioRange{}); err != nil {
+		return err
+	}
+	return f.file.Chmod(mode)
+}
+
+func (f *faultFile) Chown(uid, gid int) error {
+	if err := f.fault("Chown", ioRange{}); err != nil {
+		return err
+	}
+	return f.file.Chown(uid, gid)
+}
+
+func (f *faultFile) Close() error {
+	err := f.fault("Close", ioRange{})
+	closeErr := f.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (f *faultFile) Name() string {
+	return f.file.Name()
+}
+
+func (f *faultFile) Read(b []byte) (n int, err error) {
+	if err := f.fault("Read", ioRange{n: int64(len(b)), cursor: f.file}); err != nil {
+		return 0, err
+	}
+	return f.file.Read(b)
+}
+
+func (f *faultFile) ReadAt(b []byte, off int64) (n int, err error) {
+	if err := f.fault("ReadAt", ioRange{off: off, n: int64(len(b))}); err != nil {
+		return 0, err
+	}
+	return f.file.ReadAt(b, off)
+}
+
+func (f *faultFile) ReadDir(n int) ([]os.DirEntry, error) {
+	if err := f.fault("ReadDir", ioRange{}); err != nil {
+		return nil, err
+	}
+	return f.file.ReadDir(n)
+}
+
+// ReadFrom goes through Write, so write rules apply to it
+func (f *faultFile) ReadFrom(r io.Reader) (n int64, err error) {
+	return io.Copy(faultFileWriter{f}, r)
+}
+
+// faultFileWriter hides ReadFrom of faultFile from io.Copy
+type faultFileWriter struct {
+	f *faultFile
+}
+
+func (w faultFileWriter) Write(b []byte) (n int, err error) {
+	return w.f.Write(b)
+}
+
+func (f *faultFile) Readdir(n int) ([]os.FileInfo, error) {
+	if err := f.fault("Readdir", ioRange{}); err != nil {
+		return nil, err
+	}
+	return f.file.Readdir(n)
+}
+
+func (f *faultFile) Readdirnames(n int) (names []string, err error) {
+	if err := f.fault("Readdirnames", ioRange{}); err != nil {
+		return nil, err
+	}
+	return f.file.Readdirnames(n)
+}
+
+func (f *faultFile) Seek(offset int64, whence int) (ret int64, err error) {
+	if err := f.fault("Seek", ioRange{}); err != nil {
+		return 0, err
+	}
+	return f.file.Seek(offset, whence)
+}
+
+func (f *faultFile) Stat() (os.FileInfo, error) {
+	if err := f.fault("Stat", ioRange{}); err != nil {
+		return nil, err
+	}
+	return f.file.Stat()
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fault("Sync", ioRange{}); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if err := f.fault("Truncate", ioRange{}); err != nil {
+		return err
+	}
+	return f.file.Truncate(size)
+}
+
+func (f *faultFile) Write(b []byte) (n int, err error) {
+	if err := f.fault("Write", ioRange{n: int64(len(b)), cursor: f.file}); err != nil {
+		return 0, err
+	}
+	return f.file.Write(b)
+}
+
+func (f *faultFile) WriteAt(b []byte, off int64) (n int, err error) {
+	if err := f.fault("WriteAt", ioRange{off: off, n: int64(len(b))}); err != nil {
+		return 0, err
+	}
+	return f.file.WriteAt(b, off)
+}
+
+func (f *faultFile) WriteString(s string) (n int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *faultFile) IsFake() bool {
+	return f.file.IsFake()
+}
+
+func (f *faultFile) SetDeadline(t time.Time) error {
+	return f.file.SetDeadline(t)
+}
+
+func (f *faultFile) SetReadDeadline(t time.Time) error {
+	return f.file.SetReadDeadline(t)
+}
+
+func (f *faultFile) SetWriteDeadline(t time.Time) error {
+	return f.file.SetWriteDeadline(t)
+}
@@ -14,6 +14,7 @@ type FS interface {
 	Chdir(dir string) error
 	Chmod(name string, mode os.FileMode) error
 	Chown(name string, uid, gid int) error
+	Lchown(name string, uid, gid int) error
 	Mkdir(name string, perm os.FileMode) error
 	MkdirAll(path string, perm os.FileMode) error
 	MkdirTemp(dir, pattern string) (string, error)
@@ -27,11 +28,53 @@ type FS interface {
 	Truncate(name string, size int64) error
 	WriteFile(name string, data []byte, perm os.FileMode) error
 	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Symlink(oldname, newname string) error
+	Link(oldname, newname string) error
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+	Statfs(path string) (FsStat, error)
+}
+
+// FsStat describes capacity of filesystem containing a file, like statfs(2)
+type FsStat struct {
+	TotalBytes  uint64
+	FreeBytes   uint64 // available for unprivileged user
+	TotalInodes uint64
+	FreeInodes  uint64
 }
 
 type File struct {
 	mockFile *FakeFile
 	osFile   *os.File
+	wrapped  fileImpl // file of wrapper filesystem, e.g. FaultFS
+}
+
+// fileImpl is implemented by files of wrapper filesystems. Wrappers are not on hot path,
+// so they may afford interface.
+type fileImpl interface {
+	Fd() uintptr
+	Chdir() error
+	Chmod(mode os.FileMode) error
+	Chown(uid, gid int) error
+	Close() error
+	Name() string
+	Read(b []byte) (n int, err error)
+	ReadAt(b []byte, off int64) (n int, err error)
+	ReadDir(n int) ([]os.DirEntry, error)
+	ReadFrom(r io.Reader) (n int64, err error)
+	Readdir(n int) ([]os.FileInfo, error)
+	Readdirnames(n int) (names []string, err error)
+	Seek(offset int64, whence int) (ret int64, err error)
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+	Write(b []byte) (n int, err error)
+	WriteAt(b []byte, off int64) (n int, err error)
+	WriteString(s string) (n int, err error)
+	IsFake() bool
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
 }
 
 var _ io.ReadCloser = &File{}
@@ -46,6 +89,9 @@ func (f *File) Fd() uintptr {
 	if f.osFile != nil {
 		return f.osFile.Fd()
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Fd()
+	}
 	return 0
 }
 
@@ -53,6 +99,9 @@ func (f *File) Chdir() error {
 	if f.osFile != nil {
 		return f.osFile.Chdir()
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Chdir()
+	}
 	return f.mockFile.Chdir()
 }
 
@@ -60,6 +109,9 @@ func (f *File) Chmod(mode os.FileMode) error {
 	if f.osFile != nil {
 		return f.osFile.Chmod(mode)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Chmod(mode)
+	}
 	return f.mockFile.Chmod(mode)
 }
 
@@ -67,14 +119,19 @@ func (f *File) Chown(uid, gid int) error {
 	if f.osFile != nil {
 		return f.osFile.Chown(uid, gid)
 	}
-	// fs ownership is not implemented
-	return nil
+	if f.wrapped != nil {
+		return f.wrapped.Chown(uid, gid)
+	}
+	return f.mockFile.Chown(uid, gid)
 }
 
 func (f *File) Close() error {
 	if f.osFile != nil {
 		return f.osFile.Close()
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Close()
+	}
 	return f.mockFile.Close()
 }
 
@@ -82,6 +139,9 @@ func (f *File) Name() string {
 	if f.osFile != nil {
 		return f.osFile.Name()
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Name()
+	}
 	return f.mockFile.Name()
 }
 
@@ -89,6 +149,9 @@ func (f *File) Read(b []byte) (n int, err error) {
 	if f.osFile != nil {
 		return f.osFile.Read(b)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Read(b)
+	}
 	return f.mockFile.Read(b)
 }
 
@@ -96,6 +159,9 @@ func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
 	if f.osFile != nil {
 		return f.osFile.ReadAt(b, off)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.ReadAt(b, off)
+	}
 	return f.mockFile.ReadAt(b, off)
 }
 
@@ -103,6 +169,9 @@ func (f *File) ReadDir(n int) ([]os.DirEntry, error) {
 	if f.osFile != nil {
 		return f.osFile.ReadDir(n)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.ReadDir(n)
+	}
 	return f.mockFile.ReadDir(n)
 }
 
@@ -110,6 +179,9 @@ func (f *File) ReadFrom(r io.Reader) (n int64, err error) {
 	if f.osFile != nil {
 		return f.osFile.ReadFrom(r)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.ReadFrom(r)
+	}
 	return f.mockFile.ReadFrom(r)
 }
 
@@ -117,6 +189,9 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 	if f.osFile != nil {
 		return f.osFile.Readdir(n)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Readdir(n)
+	}
 	return f.mockFile.Readdir(n)
 }
 
@@ -124,6 +199,9 @@ func (f *File) Readdirnames(n int) (names []string, err error) {
 	if f.osFile != nil {
 		return f.osFile.Readdirnames(n)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Readdirnames(n)
+	}
 	return f.mockFile.Readdirnames(n)
 }
 
@@ -131,6 +209,9 @@ func (f *File) Seek(offset int64, whence int) (ret int64, err error) {
 	if f.osFile != nil {
 		return f.osFile.Seek(offset, whence)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Seek(offset, whence)
+	}
 	return f.mockFile.Seek(offset, whence)
 }
 
@@ -138,6 +219,9 @@ func (f *File) Stat() (os.FileInfo, error) {
 	if f.osFile != nil {
 		return f.osFile.Stat()
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Stat()
+	}
 	return f.mockFile.Stat()
 }
 
@@ -145,6 +229,9 @@ func (f *File) Sync() error {
 	if f.osFile != nil {
 		return f.osFile.Sync()
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Sync()
+	}
 	return f.mockFile.Sync()
 }
 
@@ -152,6 +239,9 @@ func (f *File) Truncate(size int64) error {
 	if f.osFile != nil {
 		return f.osFile.Truncate(size)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Truncate(size)
+	}
 	return f.mockFile.Truncate(size)
 }
 
@@ -159,6 +249,9 @@ func (f *File) Write(b []byte) (n int, err error) {
 	if f.osFile != nil {
 		return f.osFile.Write(b)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.Write(b)
+	}
 	return f.mockFile.Write(b)
 }
 
@@ -166,6 +259,9 @@ func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 	if f.osFile != nil {
 		return f.osFile.WriteAt(b, off)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.WriteAt(b, off)
+	}
 	return f.mockFile.WriteAt(b, off)
 }
 
@@ -173,6 +269,9 @@ func (f *File) WriteString(s string) (n int, err error) {
 	if f.osFile != nil {
 		return f.osFile.WriteString(s)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.WriteString(s)
+	}
 	return f.mockFile.WriteString(s)
 }
 
@@ -182,11 +281,17 @@ func (f *File) WriteTo(w io.Writer) (n int64, err error) {
 	if f.osFile != nil {
 		return f.osFile.WriteTo(w)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.WriteTo(w)
+	}
 	return f.mockFile.WriteTo(w)
 }
 */
 
 func (f *File) IsFake() bool {
+	if f.wrapped != nil {
+		return f.wrapped.IsFake()
+	}
 	return f.osFile == nil
 }
 
@@ -194,6 +299,9 @@ func (f *File) SetDeadline(t time.Time) error {
 	if f.osFile != nil {
 		return f.osFile.SetDeadline(t)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.SetDeadline(t)
+	}
 	// noop
 	return nil
 }
@@ -202,6 +310,9 @@ func (f *File) SetReadDeadline(t time.Time) error {
 	if f.osFile != nil {
 		return f.osFile.SetReadDeadline(t)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.SetReadDeadline(t)
+	}
 	// noop
 	return nil
 }
@@ -210,6 +321,9 @@ func (f *File) SetWriteDeadline(t time.Time) error {
 	if f.osFile != nil {
 		return f.osFile.SetWriteDeadline(t)
 	}
+	if f.wrapped != nil {
+		return f.wrapped.SetWriteDeadline(t)
+	}
 	// noop
 	return nil
 }
@@ -254,6 +368,10 @@ func (osFs) Chown(name string, uid, gid int) error {
 	return os.Chown(name, uid, gid)
 }
 
+func (osFs) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
 func (osFs) Mkdir(name string, perm os.FileMode) error {
 	return os.Mkdir(name, perm)
 }
@@ -305,3 +423,23 @@ func (osFs) ReadDir(name string) ([]os.DirEntry, error) {
 func (osFs) Stat(name string) (os.FileInfo, error) {
 	return os.Stat(name)
 }
+
+func (osFs) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFs) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (osFs) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (osFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (osFs) Statfs(path string) (FsStat, error) {
+	return statfs(path)
+}
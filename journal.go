@@ -0,0 +1,179 @@
+package gofs
+
+import (
+	"os"
+	"syscall"
+)
+
+type nsOpKind int
+
+const (
+	nsCreate nsOpKind = iota // new name of inode, including mkdir and link
+	nsUnlink
+	nsRename
+)
+
+// nsOp is namespace change, which is not durable until Sync of its directory
+type nsOp struct {
+	kind     nsOpKind
+	dir      *memData // directory of the name, for rename it's old directory
+	name     string
+	inode    *memData
+	newDir   *memData // rename only
+	newName  string   // rename only
+	replaced *memData // rename only, inode previously named newName, if any
+}
+
+// inodes returns inodes op refers to
+func (op nsOp) inodes() []*memData {
+	if op.replaced != nil {
+		return []*memData{op.inode, op.replaced}
+	}
+	return []*memData{op.inode}
+}
+
+// logOp remembers namespace change until it's durable. Inodes mentioned in journal are not released, so
+// crash could bring them back. Should be called with locked fs mutex, but not inode mutexes.
+func (f *InMemoryFS) logOp(op nsOp) {
+	if !f.trackDirtyPages {
+		return
+	}
+	for _, inode := range op.inodes() {
+		if inode.threadSafeMode {
+			inode.mu.Lock()
+		}
+		inode.journaled++
+		if inode.threadSafeMode {
+			inode.mu.Unlock()
+		}
+	}
+	f.journal = append(f.journal, op)
+}
+
+// syncDir makes namespace changes in directory durable. Should be called with locked fs mutex.
+func (f *FakeFile) syncDir() error {
+	if f.data.threadSafeMode {
+		f.data.mu.Lock()
+	}
+	valid := f.valid
+	if f.data.threadSafeMode {
+		f.data.mu.Unlock()
+	}
+	if !valid {
+		return os.ErrInvalid
+	}
+	if _, fail := f.data.fs.syncFails(f.name); fail {
+		return MakeWrappedError("Sync", f.name, syscall.EIO)
+	}
+	f.data.fs.commitDir(f.data)
+	return nil
+}
+
+// commitDir makes changes of directory durable. Like in journaling fs, changes are committed in order,
+// so everything before the last change of directory becomes durable as well.
+func (f *InMemoryFS) commitDir(dir *memData) {
+	n := 0
+	for i, op := range f.journal {
+		if op.dir == dir || op.newDir == dir {
+			n = i + 1
+		}
+	}
+	f.dropJournal(n)
+}
+
+// dropJournal forgets first n changes and frees inodes, which were kept only for them
+func (f *InMemoryFS) dropJournal(n int) {
+	for _, op := range f.journal[:n] {
+		for _, inode := range op.inodes() {
+			if inode.threadSafeMode {
+				inode.mu.Lock()
+			}
+			inode.journaled--
+			inode.releaseIfUnused()
+			if inode.threadSafeMode {
+				inode.mu.Unlock()
+			}
+		}
+	}
+	rest := copy(f.journal, f.journal[n:])
+	clear(f.journal[rest:])
+	f.journal = f.journal[:rest]
+}
+
+// crashJournal undoes not durable changes after the point journal reached the disk, which is decided
+// with choose. Renames are atomic, order of changes is preserved, like with ext4 data=ordered.
+func (f *InMemoryFS) crashJournal(choose func(n int) int) {
+	keep := choose(len(f.journal) + 1)
+	for i := len(f.journal) - 1; i >= keep; i-- {
+		f.undo(f.journal[i])
+	}
+	f.dropJournal(len(f.journal))
+}
+
+// undo reverts namespace change. Changes made after it should be already reverted.
+func (f *InMemoryFS) undo(op nsOp) {
+	switch op.kind {
+	case nsCreate:
+		f.detach(op.dir, op.name, op.inode)
+	case nsUnlink:
+		f.attach(op.dir, op.name, op.inode)
+	case nsRename:
+		delete(op.newDir.children, op.newName)
+		op.dir.children[op.name] = op.inode
+		nlinkDelta := 0
+		if op.inode.isDir() {
+			op.inode.parent = op.dir
+			nlinkDelta = 1
+		}
+		f.dirChanged(op.newDir, -nlinkDelta)
+		f.dirChanged(op.dir, nlinkDelta)
+		if to := op.dir.childQuota(); op.inode.quota != to {
+			_ = f.moveQuota(op.inode, to, true)
+		}
+		if op.replaced != nil {
+			f.attach(op.newDir, op.newName, op.replaced)
+		}
+	}
+}
+
+// attach brings back name of removed inode
+func (f *InMemoryFS) attach(dir *memData, name string, inode *memData) {
+	dir.children[name] = inode
+	nlinkDelta := 0
+	if inode.isDir() {
+		inode.parent = dir
+		nlinkDelta = 1
+	}
+	f.dirChanged(dir, nlinkDelta)
+
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	if inode.isDir() {
+		inode.nlink = 2 // only empty directory could be removed
+	} else {
+		inode.nlink++
+	}
+	inode.attachSpace()
+}
+
+// detach removes name of inode, without releasing it
+func (f *InMemoryFS) detach(dir *memData, name string, inode *memData) {
+	delete(dir.children, name)
+	nlinkDelta := 0
+	if inode.isDir() {
+		nlinkDelta = -1
+	}
+	f.dirChanged(dir, nlinkDelta)
+
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	if inode.isDir() {
+		inode.nlink = 0
+	} else {
+		inode.nlink--
+	}
+}
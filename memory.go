@@ -4,10 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 	"unsafe"
 
@@ -44,13 +44,31 @@ type interval struct {
 }
 
 type memData struct {
-	buff        []byte
-	realName    string // this is synced with inodes map
-	isDirectory bool
-	fs          *InMemoryFS // TODO: move to FakeFile?
-	parent      *memData
-	perm        os.FileMode
-	dirtyPages  []interval // well... it's not exactly pages...
+	buff       []byte
+	mode       os.FileMode         // type, permission and setuid, setgid, sticky bits
+	linkTarget string              // only for symlinks
+	children   map[string]*memData // only for directories, guarded by fs mutex
+	parent     *memData            // only for directories, root is parent of itself
+	fs         *InMemoryFS         // TODO: move to FakeFile?
+	dirtyPages []interval          // well... it's not exactly pages...
+	durable    []byte              // content as on disk, maintained only with dirty pages tracking
+	minSize    int64               // minimal size since last sync, durable content after it is truncated
+	badSectors map[int64]bool      // unreadable sectors, value tells if rewrite heals it
+	rotTime    time.Time           // content ages for bit rot since then
+	ino        uint64
+	nlink      int // number of names in fs, for directory it's 2 + number of subdirectories (like in linux)
+	openCount  int // number of not closed FakeFile
+	atime      time.Time
+	mtime      time.Time
+	ctime      time.Time
+	uid        int
+	gid        int
+	quota      *quota // quota inode is charged to, nil if there is none
+	subQuota   *quota // quota rooted at this directory
+	charged    int64  // bytes charged to fs and quota, guarded by fs capMu
+	journaled  int    // number of not durable namespace changes referring to inode
+	// removed inode is kept only for journal, its space and not durable content are released
+	spaceDetached bool
 
 	mu             sync.Mutex
 	threadSafeMode bool
@@ -59,22 +77,103 @@ type memData struct {
 func (m *memData) reset() {
 	clear(m.buff[:cap(m.buff)]) // Zero all elements
 	m.buff = m.buff[:0]
-	m.perm = 0
-	m.isDirectory = false
+	m.mode = 0
+	m.linkTarget = ""
+	m.children = nil
+	m.parent = nil
+	m.nlink = 0
+	m.openCount = 0
+	m.dirtyPages = m.dirtyPages[:0]
+	m.durable = m.durable[:0]
+	m.minSize = 0
+	m.quota = nil
+	m.subQuota = nil
+	m.charged = 0
+	m.journaled = 0
+	m.spaceDetached = false
+	m.badSectors = nil
+	m.rotTime = time.Time{}
+}
+
+func (m *memData) isDir() bool {
+	return m.mode.IsDir()
+}
+
+func (m *memData) isSymlink() bool {
+	return m.mode&os.ModeSymlink != 0
+}
+
+// chmodBits is the part of mode, that may be changed by Chmod
+const chmodBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// chmod changes permission and special bits, leaving file type as is. Should be called with locked mutex.
+func (m *memData) chmod(mode os.FileMode) {
+	m.mode = m.mode.Type() | mode&chmodBits
+	m.ctime = m.fs.now()
+}
+
+// chown change owner, -1 means do not change value. Should be called with locked mutex.
+func (m *memData) chown(uid, gid int) {
+	if uid != -1 {
+		m.uid = uid
+	}
+	if gid != -1 {
+		m.gid = gid
+	}
+	if !m.isDir() {
+		m.dropPrivs() // like linux, even when done by root
+	}
+	m.ctime = m.fs.now()
+}
+
+// dropPrivs clears setuid bit and setgid bit, if latter means set group on exec (group execute is set). Kernel
+// does so on chown of non-directory, and on change of file content by unprivileged process.
+// Should be called with locked mutex.
+func (m *memData) dropPrivs() {
+	m.mode &^= os.ModeSetuid
+	if m.mode&0o010 != 0 {
+		m.mode &^= os.ModeSetgid
+	}
+}
+
+func (m *memData) setAllTimes(t time.Time) {
+	m.atime = t
+	m.mtime = t
+	m.ctime = t
+}
+
+// releaseIfUnused frees inode and its space, if file is removed and there is no open descriptor for it.
+// Removal not made durable yet may be undone by Crash, so such inode is kept detached until then. Memory of
+// regular files is returned to pool. Should be called with locked mutex.
+func (m *memData) releaseIfUnused() {
+	if m.nlink > 0 || m.openCount > 0 {
+		return
+	}
+	if m.journaled > 0 {
+		m.detachSpace()
+		return
+	}
+	if !m.spaceDetached {
+		m.freeInode()
+	}
+	if m.mode.IsRegular() {
+		filePool.Put(m)
+	}
 }
 
 func (m *memData) Size() int64 {
+	if m.isSymlink() {
+		return int64(len(m.linkTarget))
+	}
 	return int64(len(m.buff))
 }
 
 func (m *memData) hasWritePerm() bool {
-	const anyWritePerm = 0222
-	return m.perm&anyWritePerm != 0
+	return m.fs.hasPerm(m, permWrite)
 }
 
 func (m *memData) hasReadPerm() bool {
-	const anyReadPerm = 0444
-	return m.perm&anyReadPerm != 0
+	return m.fs.hasPerm(m, permRead)
 }
 
 // Kinda like descriptor
@@ -88,8 +187,12 @@ type FakeFile struct {
 	valid         bool
 }
 
+// Chdir changes working directory to the one file refers to, even if it was moved since open
 func (f *FakeFile) Chdir() error {
 	if f.data.threadSafeMode {
+		// working directory and tree are guarded by fs mutex, lock order is fs, then inode
+		f.data.fs.mu.Lock()
+		defer f.data.fs.mu.Unlock()
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
 	}
@@ -97,14 +200,24 @@ func (f *FakeFile) Chdir() error {
 	if !f.valid {
 		return os.ErrInvalid
 	}
-	if !f.data.isDirectory {
-		return MakeError("Chdir", f.name, "not a directory")
+	if !f.data.isDir() {
+		return MakeWrappedError("Chdir", f.name, syscall.ENOTDIR)
+	}
+	if !f.data.fs.hasPerm(f.data, permExecute) {
+		return MakeWrappedError("Chdir", f.name, os.ErrPermission)
+	}
+	if f.data.nlink > 0 {
+		f.data.fs.workDirName = dirPath(f.data)
 	}
-	return f.data.fs.Chdir(f.name)
+	f.data.fs.workDir = f.data
+	return nil
 }
 
 func (f *FakeFile) Chmod(mode os.FileMode) error {
 	if f.data.threadSafeMode {
+		// credentials are guarded by fs mutex
+		f.data.fs.mu.Lock()
+		defer f.data.fs.mu.Unlock()
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
 	}
@@ -112,11 +225,30 @@ func (f *FakeFile) Chmod(mode os.FileMode) error {
 	if !f.valid {
 		return os.ErrInvalid
 	}
-	f.data.perm = mode & fs.ModePerm
+	if !f.data.fs.isOwner(f.data) {
+		return MakeWrappedError("Chmod", f.name, syscall.EPERM)
+	}
+	f.data.chmod(mode)
 	return nil
 }
 
-func (f *FakeFile) Chown(uid, gid int) error { panic("todo") }
+func (f *FakeFile) Chown(uid, gid int) error {
+	if f.data.threadSafeMode {
+		f.data.fs.mu.Lock()
+		defer f.data.fs.mu.Unlock()
+		f.data.mu.Lock()
+		defer f.data.mu.Unlock()
+	}
+
+	if !f.valid {
+		return os.ErrInvalid
+	}
+	if !f.data.fs.canChown(f.data, uid, gid) {
+		return MakeWrappedError("Chown", f.name, syscall.EPERM)
+	}
+	f.data.chown(uid, gid)
+	return nil
+}
 
 func (f *FakeFile) Close() error {
 	if f.data.threadSafeMode {
@@ -131,6 +263,11 @@ func (f *FakeFile) Close() error {
 	f.valid = false
 	clear(f.readDirSlice)
 	clear(f.readDirSlice2)
+	f.data.openCount--
+	f.data.fs.filesMu.Lock()
+	delete(f.data.fs.openFiles, f)
+	f.data.fs.filesMu.Unlock()
+	f.data.releaseIfUnused()
 	return nil
 }
 
@@ -187,21 +324,43 @@ func (f *FakeFile) pread(b []byte, off int64) (n int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	if f.data.isDir() {
+		return 0, syscall.EISDIR
+	}
 	if !util.HasReadPerm(f.flag) {
 		return 0, fmt.Errorf("%w file open without write permission", os.ErrPermission)
 	}
-	if off > int64(len(f.data.buff)) {
+	if s := f.data.fs.shortIO.Load(); s != nil {
+		b = b[:shortLen(s.reads, len(b))]
+	}
+	if off >= int64(len(f.data.buff)) {
 		return 0, io.EOF
 	}
+	if bad := f.data.badOffset(off, min(off+int64(len(b)), int64(len(f.data.buff)))); bad == off {
+		return 0, syscall.EIO
+	} else if bad >= 0 {
+		b = b[:bad-off]
+	}
+	br := f.data.fs.bitRot.Load()
+	if br != nil && br.mode == BitRotInStorage {
+		f.data.rotStored(br)
+	}
 	n = copy(b, f.data.buff[off:])
 	if n == 0 {
 		return 0, io.EOF
 	}
+	if br != nil && br.mode == BitRotOnRead {
+		f.data.rotRead(br, b[:n])
+	}
+	f.data.atime = f.data.fs.now()
 	return n, nil
 }
 
 func (f *FakeFile) ReadDir(n int) ([]os.DirEntry, error) {
 	if f.data.threadSafeMode {
+		// directory content is guarded by fs mutex, lock order is fs, then inode
+		f.data.fs.mu.Lock()
+		defer f.data.fs.mu.Unlock()
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
 	}
@@ -209,19 +368,24 @@ func (f *FakeFile) ReadDir(n int) ([]os.DirEntry, error) {
 	if !f.valid {
 		return nil, os.ErrInvalid
 	}
-	if !f.data.isDirectory {
+	if !f.data.isDir() {
 		return nil, MakeError("ReadDir", f.name, "not a directory")
 	}
 	if f.readDirSlice == nil {
-		content, err := f.data.fs.getDirContent(f.name)
-		_ = err // TODO
-		for i := range content {
-			if content[i].threadSafeMode {
-				content[i].mu.Lock()
+		f.data.atime = f.data.fs.now()
+		// names are readable without search permission, but entries can't be stat'ed
+		searchable := f.data.fs.hasPerm(f.data, permExecute)
+		for name, inode := range f.data.children {
+			if inode.threadSafeMode {
+				inode.mu.Lock()
 			}
-			f.readDirSlice = append(f.readDirSlice, NewInfoDataFromNode(content[i], content[i].realName))
-			if content[i].threadSafeMode {
-				content[i].mu.Unlock()
+			info := NewInfoDataFromNode(inode, name)
+			if !searchable {
+				info.infoErr = MakeWrappedError("lstat", filepath.Join(f.name, name), os.ErrPermission)
+			}
+			f.readDirSlice = append(f.readDirSlice, info)
+			if inode.threadSafeMode {
+				inode.mu.Unlock()
 			}
 		}
 	}
@@ -240,6 +404,9 @@ func (f *FakeFile) ReadDir(n int) ([]os.DirEntry, error) {
 
 func (f *FakeFile) Readdir(n int) ([]os.FileInfo, error) {
 	if f.data.threadSafeMode {
+		// directory content is guarded by fs mutex, lock order is fs, then inode
+		f.data.fs.mu.Lock()
+		defer f.data.fs.mu.Unlock()
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
 	}
@@ -247,19 +414,23 @@ func (f *FakeFile) Readdir(n int) ([]os.FileInfo, error) {
 	if !f.valid {
 		return nil, os.ErrInvalid
 	}
-	if !f.data.isDirectory {
+	if !f.data.isDir() {
 		return nil, MakeError("ReadDir", f.name, "not a directory")
 	}
 	if f.readDirSlice2 == nil {
-		content, err := f.data.fs.getDirContent(f.name)
-		_ = err // TODO
-		for i := range content {
-			if content[i].threadSafeMode {
-				content[i].mu.Lock()
+		if !f.data.fs.hasPerm(f.data, permExecute) {
+			for name := range f.data.children {
+				return nil, MakeWrappedError("lstat", filepath.Join(f.name, name), os.ErrPermission)
+			}
+		}
+		f.data.atime = f.data.fs.now()
+		for name, inode := range f.data.children {
+			if inode.threadSafeMode {
+				inode.mu.Lock()
 			}
-			f.readDirSlice2 = append(f.readDirSlice2, NewInfoDataFromNode(content[i], content[i].realName))
-			if content[i].threadSafeMode {
-				content[i].mu.Unlock()
+			f.readDirSlice2 = append(f.readDirSlice2, NewInfoDataFromNode(inode, name))
+			if inode.threadSafeMode {
+				inode.mu.Unlock()
 			}
 		}
 	}
@@ -277,11 +448,6 @@ func (f *FakeFile) Readdir(n int) ([]os.FileInfo, error) {
 }
 
 func (f *FakeFile) Readdirnames(n int) (names []string, err error) {
-	if f.data.threadSafeMode {
-		f.data.mu.Lock()
-		defer f.data.mu.Unlock()
-	}
-
 	di, err := f.ReadDir(n)
 	out := make([]string, len(di))
 	for i := range di {
@@ -318,6 +484,11 @@ type fileWithoutReadFrom struct {
 	*FakeFile
 }
 
+// Write does not return short writes, like os.File
+func (f fileWithoutReadFrom) Write(b []byte) (n int, err error) {
+	return f.writeAll(b)
+}
+
 func (f *FakeFile) Seek(offset int64, whence int) (ret int64, err error) {
 	if f.data.threadSafeMode {
 		f.data.mu.Lock()
@@ -359,7 +530,17 @@ func (f *FakeFile) Stat() (os.FileInfo, error) {
 	return info, nil
 }
 
+// Sync makes written content durable, see Crash and SetSyncFailure. For directory it makes durable namespace
+// changes in it.
 func (f *FakeFile) Sync() error {
+	f.data.fs.mutating("Sync", f.name)
+	if f.data.threadSafeMode {
+		f.data.fs.mu.Lock()
+		defer f.data.fs.mu.Unlock()
+	}
+	if f.data.isDir() {
+		return f.syncDir()
+	}
 	if f.data.threadSafeMode {
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
@@ -368,11 +549,15 @@ func (f *FakeFile) Sync() error {
 	if !f.valid {
 		return os.ErrInvalid
 	}
-	f.data.dirtyPages = f.data.dirtyPages[:0]
+	if mode, fail := f.data.fs.syncFails(f.name); fail {
+		return f.failSync(mode)
+	}
+	f.data.sync()
 	return nil
 }
 
 func (f *FakeFile) Truncate(size int64) error {
+	f.data.fs.mutating("Truncate", f.name)
 	if f.data.threadSafeMode {
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
@@ -387,12 +572,11 @@ func (f *FakeFile) Truncate(size int64) error {
 	if !util.HasWritePerm(f.flag) {
 		return MakeWrappedError("Truncate", f.name, os.ErrInvalid) // yes, not ErrPermission
 	}
-	f.data.buff = util.ResizeSlice(f.data.buff, int(size))
-	clear(f.data.buff[len(f.data.buff):cap(f.data.buff)])
-	return nil
+	return MakeWrappedError("Truncate", f.name, f.data.resize(size))
 }
 
 func (f *FakeFile) Write(b []byte) (n int, err error) {
+	f.data.fs.mutating("Write", f.name)
 	if f.data.threadSafeMode {
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
@@ -412,6 +596,7 @@ func (f *FakeFile) Write(b []byte) (n int, err error) {
 }
 
 func (f *FakeFile) WriteAt(b []byte, off int64) (n int, err error) {
+	f.data.fs.mutating("WriteAt", f.name)
 	if f.data.threadSafeMode {
 		f.data.mu.Lock()
 		defer f.data.mu.Unlock()
@@ -453,14 +638,33 @@ func (f *FakeFile) pwrite(b []byte, off int64) (n int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	if s := f.data.fs.shortIO.Load(); s != nil {
+		b = b[:shortLen(s.writes, len(b))]
+	}
 
-	if len(f.data.buff) < int(off)+len(b) {
+	f.data.rotBeforeChange()
+	if grow := off + int64(len(b)) - f.data.Size(); grow > 0 {
+		// like kernel, write as much as fits
+		var granted int64
+		granted, err = f.data.reserveBytes(grow)
+		if end := f.data.Size() + granted; end <= off {
+			f.data.releaseBytes(granted)
+			return 0, err
+		} else if granted < grow {
+			b = b[:end-off]
+		}
 		f.data.buff = util.ResizeSlice(f.data.buff, int(off)+len(b))
 	}
 	n = copy(f.data.buff[off:], b)
+	f.data.healBadSectors(off, off+int64(n))
+	if f.data.fs.uid != 0 {
+		f.data.dropPrivs()
+	}
+	f.data.mtime = f.data.fs.now()
+	f.data.ctime = f.data.mtime
 
 	f.appendDirtyPage(off, off+int64(n))
-	return n, nil
+	return n, err
 }
 
 func (f *FakeFile) appendDirtyPage(from int64, to int64) {
@@ -472,6 +676,17 @@ func (f *FakeFile) appendDirtyPage(from int64, to int64) {
 	f.data.dirtyPages = append(f.data.dirtyPages, interval{from: from, to: to})
 }
 
+// writeAll retries short writes, like os.File.Write does
+func (f *FakeFile) writeAll(b []byte) (n int, err error) {
+	for len(b) > 0 && err == nil {
+		var m int
+		m, err = f.Write(b)
+		n += m
+		b = b[m:]
+	}
+	return n, err
+}
+
 func (f *FakeFile) WriteString(s string) (n int, err error) {
 	b := unsafe.Slice(unsafe.StringData(s), len(s))
 	return f.Write(b)
@@ -507,7 +722,8 @@ type infoData struct {
 	size    int64
 	mode    os.FileMode
 	modTime time.Time
-	isDir   bool // TODO: feels like it may be in mode
+	sys     any
+	infoErr error // returned by Info, e.g. if directory entry can't be stat'ed
 }
 
 var _ os.FileInfo = &infoData{}
@@ -518,8 +734,9 @@ func NewInfoDataFromNode(inode *memData, name string) *infoData {
 	var info infoData
 	info.name = filepath.Base(name)
 	info.size = inode.Size()
-	info.mode = inode.perm
-	info.isDir = inode.isDirectory
+	info.mode = inode.mode
+	info.modTime = inode.mtime
+	info.sys = newSysStat(inode)
 	return &info
 }
 
@@ -536,22 +753,25 @@ func (m *infoData) Mode() os.FileMode {
 }
 
 func (m *infoData) ModTime() time.Time {
-	// TODO: make possibility to change modTime for test (e.g. via special function)
 	return m.modTime
 }
 
 func (m *infoData) IsDir() bool {
-	return m.isDir
+	return m.mode.IsDir()
 }
 
+// Sys returns *syscall.Stat_t filled with emulated values on linux and darwin, nil on other platforms
 func (m *infoData) Sys() any {
-	return nil
+	return m.sys
 }
 
 func (m *infoData) Type() os.FileMode {
-	return m.mode
+	return m.mode.Type()
 }
 
 func (m *infoData) Info() (os.FileInfo, error) {
+	if m.infoErr != nil {
+		return nil, m.infoErr
+	}
 	return m, nil
 }
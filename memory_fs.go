@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -13,51 +12,187 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/myxo/gofs/internal/util"
 )
 
 type InMemoryFS struct {
-	inodes          map[string]*memData
-	workDir         string
-	trackDirtyPages bool
-	threadSafeMode  bool
-	mu              sync.Mutex
+	root             *memData
+	workDir          *memData // relative paths are resolved from here
+	workDirName      string   // path used to chdir, needed only to name files
+	lastIno          uint64
+	clock            Clock
+	uid              int // credentials of emulated process, used as owner of new files
+	gid              int
+	groups           []int // supplementary groups
+	checkCredentials bool  // if false, any of owner, group or other permission bits is enough for access
+	umask            os.FileMode
+	trackDirtyPages  bool
+	threadSafeMode   bool
+	filesMu          sync.Mutex // guards openFiles, since closing a file does not take fs mutex
+	openFiles        map[*FakeFile]struct{}
+	capMu            sync.Mutex // guards capacity, usage and quotas, since file content changes without fs mutex
+	byteCapacity     int64      // zero means unlimited
+	inodeCapacity    int64
+	usedBytes        int64
+	usedInodes       int64
+	shortIO          atomic.Pointer[shortIO]
+	bitRot           atomic.Pointer[bitRot]
+	journal          []nsOp // namespace changes not made durable yet, maintained only with dirty pages tracking
+	mutationHook     func(op, name string)
+	syncFailure      *syncFailure
+	writeFaults      *writeFaults
+	mu               sync.Mutex
 }
 
 var _ FS = &InMemoryFS{}
 
 const rootDir = "/"
 
+// MemoryFsOption configures InMemoryFS on creation
+type MemoryFsOption func(*InMemoryFS)
+
+// WithClock makes fs use c for all timestamps instead of real time. See FakeClock.
+func WithClock(c Clock) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.clock = c
+	}
+}
+
+// WithCredentials sets uid, gid and supplementary groups of emulated process. By default effective credentials of
+// current process are used for file ownership, but permission checks are relaxed (any of owner, group or other
+// bits is enough). With explicit credentials fs checks permissions the same way kernel does, and uid 0 bypass them.
+func WithCredentials(uid, gid int, groups ...int) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.setCredentials(uid, gid, groups)
+	}
+}
+
+// WithUmask sets initial file mode creation mask, 022 by default. See Umask.
+func WithUmask(mask int) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.umask = os.FileMode(mask) & os.ModePerm
+	}
+}
+
 // NewMemoryFs create fake filesystem with gofs.FS interface
-func NewMemoryFs() *InMemoryFS {
+func NewMemoryFs(opts ...MemoryFsOption) *InMemoryFS {
 	ret := &InMemoryFS{
-		inodes:  map[string]*memData{},
-		workDir: rootDir,
+		workDirName: rootDir,
+		openFiles:   map[*FakeFile]struct{}{},
+		clock:       realClock{},
+		uid:         os.Geteuid(),
+		gid:         os.Getegid(),
+		umask:       0022,
+	}
+	for _, opt := range opts {
+		opt(ret)
 	}
-	ret.inodes[rootDir] = &memData{
-		realName:    rootDir,
-		isDirectory: true,
-		perm:        0666,
-		fs:          ret,
+	if br := ret.bitRot.Load(); br != nil {
+		// clock may be set by option applied after WithBitRot
+		br.since = ret.now()
 	}
+	root := &memData{
+		mode:     os.ModeDir | 0777,
+		children: map[string]*memData{},
+		fs:       ret,
+		ino:      ret.nextIno(),
+		nlink:    2,
+		uid:      ret.uid,
+		gid:      ret.gid,
+	}
+	root.parent = root
+	root.setAllTimes(ret.now())
+	ret.usedInodes = 1
+	ret.root = root
+	ret.workDir = root
 	return ret
 }
 
+func (f *InMemoryFS) nextIno() uint64 {
+	f.lastIno++
+	return f.lastIno
+}
+
+func (f *InMemoryFS) now() time.Time {
+	return f.clock.Now()
+}
+
+// dirChanged should be called on every entry creation or removal in dir. It updates times, as
+// well as link count (e.g. nlinkDelta is 1 if subdirectory was created)
+func (f *InMemoryFS) dirChanged(dir *memData, nlinkDelta int) {
+	if dir.threadSafeMode {
+		dir.mu.Lock()
+		defer dir.mu.Unlock()
+	}
+	now := f.now()
+	dir.nlink += nlinkDelta
+	dir.mtime = now
+	dir.ctime = now
+}
+
 // NewThreadSafeMemoryFs create thread safe fake fs. It's a bit slower, but you can use it in multithreading tests with -race
-func NewThreadSafeMemoryFs() *InMemoryFS {
-	ret := NewMemoryFs()
+func NewThreadSafeMemoryFs(opts ...MemoryFsOption) *InMemoryFS {
+	ret := NewMemoryFs(opts...)
 	ret.threadSafeMode = true
+	ret.root.threadSafeMode = true
 	return ret
 }
 
+// SetCredentials changes credentials of emulated process, e.g. to emulate dropping privileges. See WithCredentials.
+func (f *InMemoryFS) SetCredentials(uid, gid int, groups ...int) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	f.setCredentials(uid, gid, groups)
+}
+
+func (f *InMemoryFS) setCredentials(uid, gid int, groups []int) {
+	f.uid = uid
+	f.gid = gid
+	f.groups = slices.Clone(groups)
+	f.checkCredentials = true
+}
+
+// Umask sets file mode creation mask of emulated process and returns the previous one, like syscall.Umask.
+// Permission bits set in mask are cleared from perm passed to OpenFile, Mkdir, MkdirAll and Mknod.
+func (f *InMemoryFS) Umask(mask int) (old int) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	old = int(f.umask)
+	f.umask = os.FileMode(mask) & os.ModePerm
+	return old
+}
+
+// TrackDirtyPages makes fs remember what was written since last Sync, which is needed for CorruptDirtyPages
+// and Crash. Namespace changes are remembered too, until Sync of their directory. Content and names existing
+// at the moment are considered durable.
 func (f *InMemoryFS) TrackDirtyPages() {
 	if f.threadSafeMode {
 		f.mu.Lock()
 		defer f.mu.Unlock()
 	}
 
+	if f.trackDirtyPages {
+		return
+	}
 	f.trackDirtyPages = true
+	f.forEachInode(func(inode *memData) {
+		if inode.threadSafeMode {
+			inode.mu.Lock()
+			defer inode.mu.Unlock()
+		}
+		inode.durable = append(inode.durable[:0], inode.buff...)
+		inode.minSize = int64(len(inode.buff))
+	})
 }
 
 func (f *InMemoryFS) Create(path string) (*File, error) {
@@ -111,7 +246,7 @@ func (f *InMemoryFS) Open(name string) (*File, error) {
 	return f.OpenFile(name, os.O_RDONLY, 0)
 }
 
-func checkOpenPerm(flag int, inode *memData) error {
+func (f *InMemoryFS) checkOpenPerm(flag int, inode *memData) error {
 	if util.HasWritePerm(flag) && !inode.hasWritePerm() {
 		return os.ErrPermission
 	}
@@ -124,66 +259,212 @@ func checkOpenPerm(flag int, inode *memData) error {
 func (f *InMemoryFS) normilizePath(path string) string {
 	path = filepath.Clean(path)
 	if !filepath.IsAbs(path) {
-		path = filepath.Join(f.workDir, path)
+		path = filepath.Join(f.workDirName, path)
 	}
 	return path
 }
 
+// same as MAXSYMLINKS in linux
+const maxSymlinkFollows = 40
+
+// lookup resolves name following symlinks the way kernel does. Symlinks in intermediate components are always
+// followed, the last one only if follow is true (or name has trailing slash). It returns directory containing the
+// last component, name of the entry in that directory and the entry itself. If only the last component does not
+// exist, lookup returns nil inode and nil error, so caller may create it. If name refers to directory itself
+// (root, or ends with "." or "..") dir is nil. Every traversed directory should have search (execute) permission.
+func (f *InMemoryFS) lookup(name string, follow bool) (dir *memData, base string, inode *memData, err error) {
+	mustBeDir := strings.HasSuffix(name, "/")
+	return f.walk(name, follow || mustBeDir, mustBeDir)
+}
+
+// lookupEntry is like lookup, but for operations on entry itself, like creation, removal or rename. As in kernel,
+// the last component is never followed, and trailing slash is left for caller to check.
+func (f *InMemoryFS) lookupEntry(name string) (dir *memData, base string, inode *memData, err error) {
+	return f.walk(name, false, false)
+}
+
+// newEntryErr checks, that entry may be created with name, resolved by lookupEntry to dir and inode. Like in
+// kernel, name of existing entry or directory itself ("." and "..") can't be used, and only new directory may
+// be named with trailing slash.
+func newEntryErr(name string, dir, inode *memData, isDir bool) error {
+	if dir == nil || inode != nil {
+		return os.ErrExist
+	}
+	if !isDir && strings.HasSuffix(name, "/") {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// walk does the work of lookup. If mustBeDir is true, the last component has to be a directory.
+func (f *InMemoryFS) walk(name string, follow, mustBeDir bool) (dir *memData, base string, inode *memData, err error) {
+	if name == "" {
+		return nil, "", nil, os.ErrNotExist
+	}
+	cur := f.workDir
+	if filepath.IsAbs(name) {
+		cur = f.root
+	}
+
+	parts := strings.Split(name, "/")
+	followed := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		if part == "" {
+			continue
+		}
+		// like kernel, search permission is checked before directory is found removed
+		if !f.hasPerm(cur, permExecute) {
+			return nil, "", nil, os.ErrPermission
+		}
+		if cur.nlink == 0 { // directory was removed, e.g. working one
+			return nil, "", nil, os.ErrNotExist
+		}
+		if part == "." {
+			continue
+		}
+		if part == ".." {
+			cur = cur.parent
+			continue
+		}
+		// like kernel, "x/." requires x to be a directory
+		last := !slices.ContainsFunc(parts, func(p string) bool { return p != "" })
+
+		next := cur.children[part]
+		if next == nil {
+			if last {
+				return cur, part, nil, nil
+			}
+			return nil, "", nil, os.ErrNotExist
+		}
+		if next.isSymlink() && (!last || follow) {
+			if followed++; followed > maxSymlinkFollows {
+				return nil, "", nil, syscall.ELOOP
+			}
+			if filepath.IsAbs(next.linkTarget) {
+				cur = f.root
+			}
+			parts = append(strings.Split(next.linkTarget, "/"), parts...)
+			continue
+		}
+		if !next.isDir() && (!last || mustBeDir) {
+			return nil, "", nil, syscall.ENOTDIR
+		}
+		if last {
+			return cur, part, next, nil
+		}
+		cur = next
+	}
+	return nil, "", cur, nil
+}
+
 func (f *InMemoryFS) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	if util.IsCreate(flag) || util.IsTruncate(flag) {
+		f.mutating("OpenFile", name)
+	}
 	if f.threadSafeMode {
 		f.mu.Lock()
 		defer f.mu.Unlock()
 	}
 
+	return f.openFile(name, flag, perm, false)
+}
+
+// openFile opens or creates file. If mustBeDir is true, it behaves as if O_DIRECTORY flag is set.
+func (f *InMemoryFS) openFile(name string, flag int, perm os.FileMode, mustBeDir bool) (*File, error) {
+	if util.IsCreate(flag) && strings.HasSuffix(name, "/") {
+		// like kernel, open can't create directory, and refuses trailing slash before looking at the entry
+		if dir, _, _, err := f.lookupEntry(name); err != nil || dir != nil {
+			if err == nil {
+				err = syscall.EISDIR
+			}
+			return nil, MakeWrappedError("OpenFile", f.normilizePath(name), err)
+		}
+	}
+	follow := !(util.IsCreate(flag) && util.IsExclusive(flag))
+	dir, base, inode, err := f.lookup(name, follow)
 	name = f.normilizePath(name)
-	dirPath := filepath.Dir(name)
-	dir, dirExist := f.inodes[dirPath]
-	if !dirExist || !dir.isDirectory {
-		return nil, MakeWrappedError("OpenFile", name, os.ErrNotExist)
+	if err == nil && mustBeDir && inode != nil && !inode.isDir() {
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return nil, MakeWrappedError("OpenFile", name, err)
 	}
-	inode, ok := f.inodes[name]
-	if !ok {
+	if inode == nil {
 		if !util.IsCreate(flag) {
 			return nil, MakeWrappedError("OpenFile", name, os.ErrNotExist)
 		}
-		// TODO: check directory perms
+		if !f.canModifyDir(dir) {
+			return nil, MakeWrappedError("OpenFile", name, os.ErrPermission)
+		}
+		q, err := f.allocInode(dir)
+		if err != nil {
+			return nil, MakeWrappedError("OpenFile", name, err)
+		}
 		inode = filePool.Get().(*memData)
 		inode.reset()
-		inode.realName = name
-		inode.perm = perm
+		inode.quota = q
+		inode.mode = perm & chmodBits &^ f.umask
 		inode.fs = f
-		inode.parent = dir
+		inode.ino = f.nextIno()
+		inode.nlink = 1
+		inode.uid, inode.gid = f.newOwner(dir)
+		inode.setAllTimes(f.now())
 		inode.threadSafeMode = f.threadSafeMode
 		if !util.IsCreate(flag) { // read and write allowed with any perm if you just created the file
-			if err := checkOpenPerm(flag, inode); err != nil {
+			if err := f.checkOpenPerm(flag, inode); err != nil {
 				return nil, MakeWrappedError("OpenFile", name, os.ErrNotExist)
 			}
 		}
-		f.inodes[name] = inode
+		dir.children[base] = inode
+		f.dirChanged(dir, 0)
+		f.logOp(nsOp{kind: nsCreate, dir: dir, name: base, inode: inode})
 	} else {
 		if util.IsCreate(flag) && util.IsExclusive(flag) {
 			return nil, MakeWrappedError("OpenFile", name, os.ErrExist)
 		}
-		if err := checkOpenPerm(flag, inode); err != nil {
+		if inode.isDir() && (util.HasWritePerm(flag) || util.IsTruncate(flag) || util.IsCreate(flag)) {
+			return nil, MakeWrappedError("OpenFile", name, syscall.EISDIR)
+		}
+		if !inode.isDir() && !inode.mode.IsRegular() {
+			// there is no driver behind special files, kernel says the same about sockets
+			return nil, MakeWrappedError("OpenFile", name, syscall.ENXIO)
+		}
+		if err := f.checkOpenPerm(flag, inode); err != nil {
 			return nil, MakeWrappedError("OpenFile", name, err)
 		}
 		if util.IsTruncate(flag) {
 			if !inode.hasWritePerm() {
 				return nil, MakeWrappedError("OpenFile", name, os.ErrPermission)
 			}
-			clear(inode.buff)
-			inode.buff = inode.buff[:0]
+			_ = inode.resize(0) // shrinking never fails
 		}
 	}
 
-	return &File{
-		mockFile: &FakeFile{
-			name:  name,
-			data:  inode,
-			flag:  flag,
-			valid: true,
-		},
-	}, nil
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	inode.openCount++
+	fp := &FakeFile{
+		name:  name,
+		data:  inode,
+		flag:  flag,
+		valid: true,
+	}
+	f.filesMu.Lock()
+	f.openFiles[fp] = struct{}{}
+	f.filesMu.Unlock()
+	return &File{mockFile: fp}, nil
+}
+
+// OpenHandles returns number of files opened with fs and not closed yet, including removed ones. Useful to
+// check for descriptor leaks in tests.
+func (f *InMemoryFS) OpenHandles() int {
+	f.filesMu.Lock()
+	defer f.filesMu.Unlock()
+	return len(f.openFiles)
 }
 
 func (f *InMemoryFS) Chdir(dir string) error {
@@ -192,20 +473,26 @@ func (f *InMemoryFS) Chdir(dir string) error {
 		defer f.mu.Unlock()
 	}
 
-	dir = f.normilizePath(dir)
-	inode, ok := f.inodes[dir]
-	if !ok {
-		return MakeWrappedError("Chdir", dir, os.ErrNotExist)
+	_, _, inode, err := f.lookup(dir, true)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return MakeWrappedError("Chdir", dir, err)
 	}
 	if inode.threadSafeMode {
 		inode.mu.Lock()
 		defer inode.mu.Unlock()
 	}
-	if !inode.isDirectory {
-		return MakeError("Chdir", dir, "not an directory")
+	if !inode.isDir() {
+		return MakeWrappedError("Chdir", dir, syscall.ENOTDIR)
+	}
+	if !f.hasPerm(inode, permExecute) {
+		return MakeWrappedError("Chdir", dir, os.ErrPermission)
 	}
 
-	f.workDir = dir
+	f.workDirName = f.normilizePath(dir)
+	f.workDir = inode
 	return nil
 }
 
@@ -215,21 +502,60 @@ func (f *InMemoryFS) Chmod(name string, mode os.FileMode) error {
 		defer f.mu.Unlock()
 	}
 
-	name = f.normilizePath(name)
-	inode, ok := f.inodes[name]
-	if !ok {
-		return MakeWrappedError("Chmod", name, os.ErrNotExist)
+	_, _, inode, err := f.lookup(name, true)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return MakeWrappedError("Chmod", name, err)
 	}
 	if inode.threadSafeMode {
 		inode.mu.Lock()
 		defer inode.mu.Unlock()
 	}
-	inode.perm = mode & fs.ModePerm
+	if !f.isOwner(inode) {
+		return MakeWrappedError("Chmod", name, syscall.EPERM)
+	}
+	inode.chmod(mode)
 	return nil
 }
 
+// Chown changes uid and gid of the named file, following symlinks. A uid or gid of -1 means to not change that value.
 func (f *InMemoryFS) Chown(name string, uid, gid int) error {
-	// fs ownership is not implemented
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	return f.chown("Chown", name, uid, gid, true)
+}
+
+// Lchown is like Chown, but changes owner of symlink itself
+func (f *InMemoryFS) Lchown(name string, uid, gid int) error {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	return f.chown("Lchown", name, uid, gid, false)
+}
+
+func (f *InMemoryFS) chown(op string, name string, uid, gid int, follow bool) error {
+	_, _, inode, err := f.lookup(name, follow)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return MakeWrappedError(op, name, err)
+	}
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	if !f.canChown(inode, uid, gid) {
+		return MakeWrappedError(op, name, syscall.EPERM)
+	}
+	inode.chown(uid, gid)
 	return nil
 }
 
@@ -239,25 +565,47 @@ func (f *InMemoryFS) Mkdir(name string, perm os.FileMode) error {
 		defer f.mu.Unlock()
 	}
 
-	name = f.normilizePath(name)
-	parentPath := filepath.Dir(name)
-	parent, parentExist := f.inodes[parentPath]
-	if !parentExist || !parent.isDirectory {
-		return MakeWrappedError("Mkdir", name, os.ErrNotExist)
-	}
+	return f.mkdir(name, perm)
+}
 
-	if _, exist := f.inodes[name]; exist {
-		return MakeWrappedError("Mkdir", name, os.ErrExist)
+func (f *InMemoryFS) mkdir(name string, perm os.FileMode) error {
+	f.mutating("Mkdir", name)
+	parent, base, inode, err := f.lookupEntry(name)
+	if err == nil {
+		err = newEntryErr(name, parent, inode, true)
+	}
+	if err != nil {
+		return MakeWrappedError("Mkdir", name, err)
+	}
+	if !f.canModifyDir(parent) {
+		return MakeWrappedError("Mkdir", name, os.ErrPermission)
+	}
+	q, err := f.allocInode(parent)
+	if err != nil {
+		return MakeWrappedError("Mkdir", name, err)
 	}
 
-	inode := &memData{
-		realName:    name,
-		isDirectory: true,
-		perm:        perm,
-		fs:          f,
-		parent:      parent,
+	uid, gid := f.newOwner(parent)
+	mode := os.ModeDir | perm&(os.ModePerm|os.ModeSticky)&^f.umask // like in linux, setuid and setgid are ignored
+	if parent.mode&os.ModeSetgid != 0 {
+		mode |= os.ModeSetgid // ...but subdirectories of setgid directory inherit the bit
+	}
+	inode = &memData{
+		mode:           mode,
+		children:       map[string]*memData{},
+		parent:         parent,
+		fs:             f,
+		ino:            f.nextIno(),
+		quota:          q,
+		nlink:          2,
+		uid:            uid,
+		gid:            gid,
+		threadSafeMode: f.threadSafeMode,
 	}
-	f.inodes[name] = inode
+	inode.setAllTimes(f.now())
+	parent.children[base] = inode
+	f.dirChanged(parent, 1)
+	f.logOp(nsOp{kind: nsCreate, dir: parent, name: base, inode: inode})
 	return nil
 }
 
@@ -267,36 +615,34 @@ func (f *InMemoryFS) MkdirAll(path string, perm os.FileMode) error {
 		defer f.mu.Unlock()
 	}
 
-	parentPath := filepath.Dir(path)
-	if parentPath == "." {
-		// TODO: check if we catch this if in test
-		parentPath = f.workDir
-	}
-	parent, parentExist := f.inodes[parentPath]
-	if !parentExist {
-		if err := f.MkdirAll(parentPath, perm); err != nil {
-			return err
-		}
-		parent, parentExist = f.inodes[parentPath]
-		if !parentExist {
-			panic("internal error: cannot create parent directory")
+	return f.mkdirAll(path, perm)
+}
+
+// mkdirAll mimic os.MkdirAll implementation
+func (f *InMemoryFS) mkdirAll(path string, perm os.FileMode) error {
+	_, _, inode, err := f.lookup(path, true)
+	if err == nil && inode != nil {
+		if inode.isDir() {
+			return nil
 		}
-	} else if !parent.isDirectory {
-		return MakeError("MkdirAll", path, "parent path exist, but is't not a directory")
+		return MakeWrappedError("MkdirAll", path, syscall.ENOTDIR)
 	}
 
-	if _, exist := f.inodes[path]; exist {
-		return nil
+	parent := filepath.Dir(strings.TrimRight(path, "/"))
+	if parent != "." && parent != rootDir {
+		if err := f.mkdirAll(parent, perm); err != nil {
+			return err
+		}
 	}
 
-	inode := &memData{
-		realName:    path,
-		isDirectory: true,
-		perm:        perm,
-		fs:          f,
-		parent:      parent,
+	if err := f.mkdir(path, perm); err != nil {
+		// Handle arguments like "foo/." by double-checking that directory doesn't exist.
+		_, _, inode, lerr := f.lookup(path, false)
+		if lerr == nil && inode != nil && inode.isDir() {
+			return nil
+		}
+		return err
 	}
-	f.inodes[path] = inode
 	return nil
 }
 
@@ -350,7 +696,7 @@ func (f *InMemoryFS) ReadFile(name string) ([]byte, error) {
 }
 
 func (f *InMemoryFS) ReadDir(name string) ([]os.DirEntry, error) {
-	fp, err := f.Open(name)
+	fp, err := f.openDir(name)
 	if err != nil {
 		return nil, err
 	}
@@ -361,9 +707,180 @@ func (f *InMemoryFS) ReadDir(name string) ([]os.DirEntry, error) {
 	return dirs, err
 }
 
-func (f *InMemoryFS) Readlink(name string) (string, error) { panic("TODO") }
+// openDir opens directory for reading like os.ReadDir does, so not a directory error has priority over permissions
+func (f *InMemoryFS) openDir(name string) (*File, error) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	return f.openFile(name, os.O_RDONLY, 0, true)
+}
+
+func (f *InMemoryFS) Readlink(name string) (string, error) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(name, false)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return "", MakeWrappedError("Readlink", name, err)
+	}
+	if !inode.isSymlink() {
+		return "", MakeWrappedError("Readlink", name, syscall.EINVAL)
+	}
+	return inode.linkTarget, nil
+}
+
+// Symlink creates newname as a symbolic link to oldname. Target is stored as is, and
+// resolved only then link is accessed, so it may be relative or dangling.
+func (f *InMemoryFS) Symlink(oldname, newname string) error {
+	f.mutating("Symlink", newname)
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	if oldname == "" { // like in linux, empty target is not a path
+		return &os.LinkError{Op: "Symlink", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	dir, base, inode, err := f.lookupEntry(newname)
+	if err == nil {
+		err = newEntryErr(newname, dir, inode, false)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "Symlink", Old: oldname, New: newname, Err: err}
+	}
+	if !f.canModifyDir(dir) {
+		return &os.LinkError{Op: "Symlink", Old: oldname, New: newname, Err: os.ErrPermission}
+	}
+	q, err := f.allocInode(dir)
+	if err != nil {
+		return &os.LinkError{Op: "Symlink", Old: oldname, New: newname, Err: err}
+	}
+
+	uid, gid := f.newOwner(dir)
+	inode = &memData{
+		mode:           os.ModeSymlink | 0777,
+		linkTarget:     oldname,
+		fs:             f,
+		ino:            f.nextIno(),
+		quota:          q,
+		nlink:          1,
+		uid:            uid,
+		gid:            gid,
+		threadSafeMode: f.threadSafeMode,
+	}
+	inode.setAllTimes(f.now())
+	dir.children[base] = inode
+	f.dirChanged(dir, 0)
+	f.logOp(nsOp{kind: nsCreate, dir: dir, name: base, inode: inode})
+	return nil
+}
+
+// Mknod creates special file: named pipe, socket, block or character device (os.ModeDevice with
+// os.ModeCharDevice), or regular file if mode has no type bits. Special files may be stat'ed, linked,
+// renamed and removed, but can't be opened. Like in linux, only root may create devices.
+func (f *InMemoryFS) Mknod(name string, mode os.FileMode) error {
+	f.mutating("Mknod", name)
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	switch mode.Type() {
+	case 0, os.ModeNamedPipe, os.ModeSocket, os.ModeDevice, os.ModeDevice | os.ModeCharDevice:
+	default:
+		return MakeWrappedError("Mknod", name, syscall.EINVAL)
+	}
+	dir, base, inode, err := f.lookupEntry(name)
+	if err == nil {
+		err = newEntryErr(name, dir, inode, false)
+	}
+	if err != nil {
+		return MakeWrappedError("Mknod", name, err)
+	}
+	if mode&os.ModeDevice != 0 && f.checkCredentials && f.uid != 0 {
+		return MakeWrappedError("Mknod", name, syscall.EPERM)
+	}
+	if !f.canModifyDir(dir) {
+		return MakeWrappedError("Mknod", name, os.ErrPermission)
+	}
+	q, err := f.allocInode(dir)
+	if err != nil {
+		return MakeWrappedError("Mknod", name, err)
+	}
+
+	uid, gid := f.newOwner(dir)
+	inode = &memData{
+		mode:           mode.Type() | mode&chmodBits&^f.umask,
+		fs:             f,
+		ino:            f.nextIno(),
+		quota:          q,
+		nlink:          1,
+		uid:            uid,
+		gid:            gid,
+		threadSafeMode: f.threadSafeMode,
+	}
+	inode.setAllTimes(f.now())
+	dir.children[base] = inode
+	f.dirChanged(dir, 0)
+	f.logOp(nsOp{kind: nsCreate, dir: dir, name: base, inode: inode})
+	return nil
+}
+
+// Link creates newname as a hard link to the oldname file. As in linux, if oldname is a symlink,
+// link is created to symlink itself.
+func (f *InMemoryFS) Link(oldname, newname string) error {
+	f.mutating("Link", newname)
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(oldname, false)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return &os.LinkError{Op: "Link", Old: oldname, New: newname, Err: err}
+	}
+	dir, base, newInode, err := f.lookupEntry(newname)
+	if err == nil {
+		err = newEntryErr(newname, dir, newInode, false)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "Link", Old: oldname, New: newname, Err: err}
+	}
+	if !f.canModifyDir(dir) {
+		return &os.LinkError{Op: "Link", Old: oldname, New: newname, Err: os.ErrPermission}
+	}
+	if inode.isDir() {
+		return &os.LinkError{Op: "Link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	if inode.quota != dir.childQuota() {
+		// like xfs, inode can't be charged to two quotas
+		return &os.LinkError{Op: "Link", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+
+	f.logOp(nsOp{kind: nsCreate, dir: dir, name: base, inode: inode})
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	inode.nlink++
+	inode.ctime = f.now()
+	dir.children[base] = inode
+	f.dirChanged(dir, 0)
+	return nil
+}
 
 func (f *InMemoryFS) Remove(name string) error {
+	f.mutating("Remove", name)
 	if f.threadSafeMode {
 		f.mu.Lock()
 		defer f.mu.Unlock()
@@ -373,99 +890,307 @@ func (f *InMemoryFS) Remove(name string) error {
 }
 
 func (f *InMemoryFS) RemoveAll(path string) error {
+	f.mutating("RemoveAll", path)
 	if f.threadSafeMode {
 		f.mu.Lock()
 		defer f.mu.Unlock()
 	}
 
+	if path == "." || strings.HasSuffix(path, "/.") {
+		// like os.RemoveAll, refuse to remove current directory
+		return MakeWrappedError("RemoveAll", path, syscall.EINVAL)
+	}
+	err := f.remove(path, false)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	// os.RemoveAll opens parent directory, if simple remove fails, and reports its error instead
+	parent := removeAllParent(path)
+	_, _, inode, err := f.lookup(parent, true)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err == nil {
+		err = f.checkOpenPerm(os.O_RDONLY, inode)
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return MakeWrappedError("OpenFile", parent, err)
+	}
+	// then entry is removed from parent by its base name, so trailing slash does not matter
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		path = trimmed
+	}
 	return f.remove(path, true)
 }
 
+// removeAllParent returns parent directory of path the same way os.RemoveAll does, without cleaning the path
+func removeAllParent(path string) string {
+	for len(path) > 1 && path[0] == '/' && path[1] == '/' {
+		path = path[1:]
+	}
+	path = strings.TrimRight(path, "/")
+	i := strings.LastIndexByte(path, '/')
+	switch {
+	case i < 0:
+		return "."
+	case i == 0:
+		return "/"
+	}
+	return path[:i]
+}
+
 func (f *InMemoryFS) remove(name string, all bool) error {
-	name = f.normilizePath(name)
-	inode, ok := f.inodes[name]
-	if !ok {
-		if all {
+	dir, base, inode, err := f.lookupEntry(name)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		if all && os.IsNotExist(err) {
 			return nil
 		}
-		return MakeWrappedError("Remove", name, os.ErrNotExist)
+		return MakeWrappedError("Remove", name, err)
 	}
-	if inode.isDirectory {
-		content, err := f.getDirContentUnsafe(name)
-		_ = err // TODO
-		if all {
-			for _, dinode := range content {
-				if err := f.remove(dinode.realName, true); err != nil {
-					return err
-				}
-			}
-		} else {
-			if len(content) != 0 {
-				return MakeError("Remove", name, "directory is not empty")
+	if dir == nil {
+		// errors of rmdir, which os.Remove reports
+		switch filepath.Base(name) {
+		case ".":
+			return MakeWrappedError("Remove", name, syscall.EINVAL)
+		case "..":
+			return MakeWrappedError("Remove", name, syscall.ENOTEMPTY)
+		}
+		return MakeWrappedError("Remove", name, syscall.EBUSY)
+	}
+	if !inode.isDir() && strings.HasSuffix(name, "/") {
+		// unlink refuses trailing slash, so os.Remove reports error of rmdir, which checks permissions first
+		if err := f.mayDelete(dir, inode); err != nil {
+			return MakeWrappedError("Remove", name, err)
+		}
+		return MakeWrappedError("Remove", name, syscall.ENOTDIR)
+	}
+	if all {
+		return f.removeAll(name, dir, base, inode)
+	}
+
+	// kernel checks permissions before emptiness of directory
+	if err := f.mayDelete(dir, inode); err != nil {
+		return MakeWrappedError("Remove", name, err)
+	}
+	if inode.isDir() && len(inode.children) != 0 {
+		return MakeWrappedError("Remove", name, syscall.ENOTEMPTY)
+	}
+	f.logOp(nsOp{kind: nsUnlink, dir: dir, name: base, inode: inode})
+	f.unlink(dir, base, inode)
+	return nil
+}
+
+// removeAll removes entry base of dir with all its content. Like os.RemoveAll, it cleans up directory content
+// even if the directory itself can't be removed.
+func (f *InMemoryFS) removeAll(name string, dir *memData, base string, inode *memData) error {
+	if inode.isDir() && len(inode.children) != 0 {
+		if !f.hasPerm(inode, permRead) || !f.hasPerm(inode, permExecute) {
+			return MakeWrappedError("Remove", name, os.ErrPermission)
+		}
+		for childName, child := range inode.children {
+			if err := f.removeAll(filepath.Join(name, childName), inode, childName, child); err != nil {
+				return err
 			}
 		}
 	}
-	delete(f.inodes, name)
+	if err := f.mayDelete(dir, inode); err != nil {
+		return MakeWrappedError("Remove", name, err)
+	}
+	f.logOp(nsOp{kind: nsUnlink, dir: dir, name: base, inode: inode})
+	f.unlink(dir, base, inode)
 	return nil
+}
+
+// unlink removes entry base from dir. Inode memory returns to pool only then there are no links
+// and no open files left.
+func (f *InMemoryFS) unlink(dir *memData, base string, inode *memData) {
+	delete(dir.children, base)
+	nlinkDelta := 0
+	if inode.isDir() {
+		nlinkDelta = -1
+	}
+	f.dirChanged(dir, nlinkDelta)
 
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	inode.ctime = f.now()
+	if inode.isDir() {
+		inode.nlink = 0
+	} else {
+		inode.nlink--
+	}
+	inode.releaseIfUnused()
 }
 
+// Rename renames (moves) oldpath to newpath with posix semantics: directory is moved with all its content, and
+// may replace only an empty directory. Note, that os.Rename additionally refuses to replace any existing
+// directory with EEXIST.
 func (f *InMemoryFS) Rename(oldpath, newpath string) error {
+	f.mutating("Rename", oldpath)
 	if f.threadSafeMode {
 		f.mu.Lock()
 		defer f.mu.Unlock()
 	}
 
-	oldpath = f.normilizePath(oldpath)
-	newpath = f.normilizePath(newpath)
-	inode, ok := f.inodes[oldpath]
-	if !ok {
-		return MakeWrappedError("Rename", oldpath, os.ErrNotExist)
+	// kernel resolves both parent directories before looking at entries themselves
+	oldDir, oldBase, inode, err := f.lookupEntry(oldpath)
+	if err != nil {
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: err}
 	}
-
-	targetDir := filepath.Dir(newpath)
-	targetDirNode, ok := f.inodes[targetDir]
-	if !ok {
+	newDir, newBase, target, err := f.lookupEntry(newpath)
+	if err != nil {
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: err}
+	}
+	if oldDir == nil || newDir == nil {
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: syscall.EBUSY}
+	}
+	if inode == nil {
 		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
 	}
+	if !inode.isDir() && (strings.HasSuffix(oldpath, "/") || strings.HasSuffix(newpath, "/")) {
+		// unless the source is a directory, trailing slash is an error
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: syscall.ENOTDIR}
+	}
+	if inode.isDir() && isAncestor(inode, newDir) {
+		// directory can't become a subdirectory of itself
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: syscall.EINVAL}
+	}
+	if target != nil && target.isDir() && isAncestor(target, oldDir) {
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: syscall.ENOTEMPTY}
+	}
 
-	if !targetDirNode.isDirectory {
-		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: os.ErrInvalid}
+	if target == inode {
+		// both names are links to the same file, posix says to do nothing
+		return nil
+	}
+	if err := f.mayDelete(oldDir, inode); err != nil {
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: err}
 	}
+	if target != nil {
+		err = f.mayDelete(newDir, target)
+	} else if !f.canModifyDir(newDir) {
+		err = os.ErrPermission
+	}
+	if err == nil && target != nil {
+		switch {
+		case inode.isDir() && !target.isDir():
+			err = syscall.ENOTDIR
+		case !inode.isDir() && target.isDir():
+			err = syscall.EISDIR
+		}
+	}
+	if err == nil && inode.isDir() && oldDir != newDir && !f.hasPerm(inode, permWrite) {
+		// moved directory's ".." entry have to be updated
+		err = os.ErrPermission
+	}
+	if err == nil && target != nil && target.isDir() && len(target.children) != 0 {
+		err = syscall.ENOTEMPTY
+	}
+	if err != nil {
+		return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: err}
+	}
+	if to := newDir.childQuota(); inode.quota != to {
+		if err := f.moveQuota(inode, to, false); err != nil {
+			return &os.LinkError{Op: "Rename", Old: oldpath, New: newpath, Err: err}
+		}
+	}
+	f.logOp(nsOp{
+		kind:     nsRename,
+		dir:      oldDir,
+		name:     oldBase,
+		inode:    inode,
+		newDir:   newDir,
+		newName:  newBase,
+		replaced: target,
+	})
+	if target != nil {
+		f.unlink(newDir, newBase, target)
+	}
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = inode
+	nlinkDelta := 0
+	if inode.isDir() {
+		inode.parent = newDir
+		nlinkDelta = 1
+	}
+	f.dirChanged(oldDir, -nlinkDelta)
+	f.dirChanged(newDir, nlinkDelta)
 
-	delete(f.inodes, oldpath)
-	f.inodes[newpath] = inode
 	if inode.threadSafeMode {
 		inode.mu.Lock()
 		defer inode.mu.Unlock()
 	}
-	inode.realName = newpath
-	inode.parent = targetDirNode
+	inode.ctime = f.now()
 	return nil
 }
 
 func (f *InMemoryFS) Truncate(name string, size int64) error {
+	f.mutating("Truncate", name)
 	if f.threadSafeMode {
 		f.mu.Lock()
 		defer f.mu.Unlock()
 	}
 
-	name = f.normilizePath(name)
-	inode, ok := f.inodes[name]
-	if !ok {
-		return MakeWrappedError("Truncate", name, os.ErrNotExist)
+	_, _, inode, err := f.lookup(name, true)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return MakeWrappedError("Truncate", name, err)
 	}
-	// TODO: code duplication with FakeFile
 	if inode.threadSafeMode {
 		inode.mu.Lock()
 		defer inode.mu.Unlock()
 	}
+	if inode.isDir() {
+		return MakeWrappedError("Truncate", name, syscall.EISDIR)
+	}
+	if !inode.mode.IsRegular() {
+		return MakeWrappedError("Truncate", name, syscall.EINVAL)
+	}
 	if !inode.hasWritePerm() {
 		return MakeWrappedError("Truncate", name, os.ErrPermission)
 	}
-	// TODO: check write permission
-	inode.buff = util.ResizeSlice(inode.buff, int(size))
-	clear(inode.buff[len(inode.buff):cap(inode.buff)])
+	return MakeWrappedError("Truncate", name, inode.resize(size))
+}
+
+// Chtimes changes the access and modification times of the named file. A zero time.Time value
+// will leave the corresponding file time unchanged.
+func (f *InMemoryFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(name, true)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return MakeWrappedError("Chtimes", name, err)
+	}
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
+	}
+	if !f.isOwner(inode) {
+		return MakeWrappedError("Chtimes", name, syscall.EPERM)
+	}
+	if !atime.IsZero() {
+		inode.atime = atime
+	}
+	if !mtime.IsZero() {
+		inode.mtime = mtime
+	}
+	inode.ctime = f.now()
 	return nil
 }
 
@@ -474,7 +1199,7 @@ func (f *InMemoryFS) WriteFile(name string, data []byte, perm os.FileMode) error
 	if err != nil {
 		return err
 	}
-	_, err = fp.Write(data)
+	_, err = fp.mockFile.writeAll(data)
 	if err1 := fp.Close(); err1 != nil && err == nil {
 		err = err1
 	}
@@ -489,12 +1214,22 @@ func (f *InMemoryFS) Release() {
 		defer f.mu.Unlock()
 	}
 
-	for _, v := range f.inodes {
-		if v != nil {
-			filePool.Put(v)
+	f.forEachInode(func(inode *memData) {
+		if inode.mode.IsRegular() {
+			filePool.Put(inode)
 		}
-	}
-	clear(f.inodes)
+	})
+	clear(f.root.children)
+	f.root.nlink = 2
+	f.journal = nil
+	f.filesMu.Lock()
+	clear(f.openFiles)
+	f.filesMu.Unlock()
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	f.usedBytes = 0
+	f.usedInodes = 1
+	f.root.subQuota = nil
 }
 
 func (f *InMemoryFS) Stat(name string) (os.FileInfo, error) {
@@ -503,13 +1238,33 @@ func (f *InMemoryFS) Stat(name string) (os.FileInfo, error) {
 		defer f.mu.Unlock()
 	}
 
-	name = f.normilizePath(name)
-	inode, ok := f.inodes[name]
-	if !ok {
-		return nil, os.ErrNotExist
+	return f.stat("Stat", name, true)
+}
+
+// Lstat is like Stat, but if name is a symbolic link, returned FileInfo describes the link itself
+func (f *InMemoryFS) Lstat(name string) (os.FileInfo, error) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	return f.stat("Lstat", name, false)
+}
+
+func (f *InMemoryFS) stat(op string, name string, follow bool) (os.FileInfo, error) {
+	_, _, inode, err := f.lookup(name, follow)
+	if err == nil && inode == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, MakeWrappedError(op, name, err)
+	}
+	if inode.threadSafeMode {
+		inode.mu.Lock()
+		defer inode.mu.Unlock()
 	}
 	// TODO: check read persmissions?
-	info := NewInfoDataFromNode(inode, inode.realName)
+	info := NewInfoDataFromNode(inode, name)
 	return info, nil
 }
 
@@ -520,9 +1275,12 @@ func (f *InMemoryFS) CorruptFile(path string, offset int64) error {
 		defer f.mu.Unlock()
 	}
 
-	fp, ok := f.inodes[path]
-	if !ok {
-		return os.ErrNotExist
+	_, _, fp, err := f.lookup(path, true)
+	if err == nil && fp == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return err
 	}
 	if offset < 0 || offset >= fp.Size() {
 		return fmt.Errorf("offset is out of file")
@@ -538,38 +1296,56 @@ func (f *InMemoryFS) CorruptDirtyPages(seedRand *rand.Rand) {
 		defer f.mu.Unlock()
 	}
 
-	for _, data := range f.inodes {
+	f.forEachInode(func(data *memData) {
 		for _, dirtyInterval := range data.dirtyPages {
 			flipByte := seedRand.Int63n(dirtyInterval.to-dirtyInterval.from) + dirtyInterval.from
 			if flipByte < int64(len(data.buff)) { // TODO: do I need this if?
 				data.buff[flipByte]++
 			}
 		}
-	}
+	})
 }
 
-func (f *InMemoryFS) getDirContent(path string) ([]*memData, error) {
-	if f.threadSafeMode {
-		f.mu.Lock()
-		defer f.mu.Unlock()
+// isAncestor reports if dir is inode itself or one of its ancestors
+func isAncestor(dir, inode *memData) bool {
+	for inode != dir {
+		if inode.parent == inode {
+			return false
+		}
+		inode = inode.parent
 	}
-	return f.getDirContentUnsafe(path)
+	return true
 }
 
-func (f *InMemoryFS) getDirContentUnsafe(path string) ([]*memData, error) {
-	if path == "." {
-		path = f.workDir
+// dirPath returns current absolute path of directory. Directory should not be removed.
+func dirPath(dir *memData) string {
+	var parts []string
+	for dir.parent != dir {
+		for name, child := range dir.parent.children {
+			if child == dir {
+				parts = append(parts, name)
+				break
+			}
+		}
+		dir = dir.parent
 	}
+	slices.Reverse(parts)
+	return rootDir + strings.Join(parts, "/")
+}
 
-	// TODO: check if have
-	var res []*memData
-	for _, node := range f.inodes {
-		if node.parent == nil {
-			continue
+// forEachInode calls fn once for every inode reachable from root, hard linked files are visited once
+func (f *InMemoryFS) forEachInode(fn func(*memData)) {
+	seen := map[*memData]struct{}{}
+	var walk func(*memData)
+	walk = func(inode *memData) {
+		if _, ok := seen[inode]; ok {
+			return
 		}
-		if node.parent.realName == path {
-			res = append(res, node)
+		seen[inode] = struct{}{}
+		fn(inode)
+		for _, child := range inode.children {
+			walk(child)
 		}
 	}
-	return res, nil
+	walk(f.root)
 }
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadSectors(t *testing.T) {
+	const sector = 512
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4*sector/16)
+	newFs := func(t *testing.T) (*gofs.InMemoryFS, *gofs.File) {
+		fs := gofs.NewThreadSafeMemoryFs()
+		require.NoError(t, fs.WriteFile("/file", content, 0666))
+		fp, err := fs.OpenFile("/file", os.O_RDWR, 0)
+		require.NoError(t, err)
+		return fs, fp
+	}
+	requireEIO := func(t *testing.T, err error) {
+		t.Helper()
+		require.ErrorIs(t, err, syscall.EIO)
+		var pathErr *os.PathError
+		require.ErrorAs(t, err, &pathErr)
+		require.Equal(t, "/file", pathErr.Path)
+	}
+
+	t.Run("read stops before bad sector", func(t *testing.T) {
+		fs, fp := newFs(t)
+		require.NoError(t, fs.AddBadSectors("/file", sector+100, 10, false))
+
+		buf := make([]byte, 4*sector)
+		n, err := fp.ReadAt(buf, 0)
+		requireEIO(t, err)
+		require.Equal(t, sector, n)
+		require.Equal(t, content[:sector], buf[:n])
+
+		n, err = fp.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, sector, n)
+		n, err = fp.Read(buf)
+		requireEIO(t, err)
+		require.Zero(t, n)
+
+		n, err = fp.ReadAt(buf[:2*sector], 2*sector)
+		require.NoError(t, err)
+		require.Equal(t, content[2*sector:], buf[:n])
+
+		_, err = fs.ReadFile("/file")
+		requireEIO(t, err)
+
+		require.NoError(t, fs.ClearBadSectors("/file"))
+		data, err := fs.ReadFile("/file")
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("rewrite heals", func(t *testing.T) {
+		fs, fp := newFs(t)
+		require.NoError(t, fs.AddBadSectors("/file", sector, 2*sector, true))
+		_, err := fp.WriteAt([]byte("partial"), sector)
+		require.NoError(t, err)
+		_, err = fp.ReadAt(make([]byte, 1), sector)
+		requireEIO(t, err)
+
+		_, err = fp.WriteAt(bytes.Repeat([]byte("x"), sector), sector)
+		require.NoError(t, err)
+		buf := make([]byte, sector)
+		_, err = fp.ReadAt(buf, sector)
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte("x"), sector), buf)
+		_, err = fp.ReadAt(buf, 2*sector)
+		requireEIO(t, err)
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("rewrite without heal", func(t *testing.T) {
+		fs, fp := newFs(t)
+		require.NoError(t, fs.AddBadSectors("/file", 0, 1, false))
+		_, err := fp.WriteAt(make([]byte, sector), 0)
+		require.NoError(t, err)
+		_, err = fp.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		_, err = fp.Read(make([]byte, 1))
+		requireEIO(t, err)
+
+		// truncated blocks are freed
+		require.NoError(t, fp.Truncate(0))
+		_, err = fp.WriteAt(content, 0)
+		require.NoError(t, err)
+		data, err := fs.ReadFile("/file")
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("eof after bad sector", func(t *testing.T) {
+		fs, fp := newFs(t)
+		require.NoError(t, fp.Truncate(int64(len(content))-10))
+		require.NoError(t, fs.AddBadSectors("/file", int64(len(content))-20, 1, false))
+		n, err := fp.ReadAt(make([]byte, 1), int64(len(content))-10)
+		require.Equal(t, io.EOF, err)
+		require.Zero(t, n)
+		_, err = fp.Seek(0, io.SeekEnd)
+		require.NoError(t, err)
+		_, err = fp.Read(make([]byte, 1))
+		require.Equal(t, io.EOF, err)
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fs, fp := newFs(t)
+		require.NoError(t, fp.Close())
+		require.ErrorIs(t, fs.AddBadSectors("/missing", 0, 1, false), os.ErrNotExist)
+		require.ErrorIs(t, fs.AddBadSectors("/", 0, 1, false), syscall.EINVAL)
+		require.ErrorIs(t, fs.AddBadSectors("/file", -1, 1, false), syscall.EINVAL)
+		require.ErrorIs(t, fs.ClearBadSectors("/missing"), os.ErrNotExist)
+	})
+}
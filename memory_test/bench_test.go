@@ -78,3 +78,58 @@ func BenchmarkInMemory(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkLargeTree checks that namespace operations do not depend on total number of files
+func BenchmarkLargeTree(b *testing.B) {
+	const (
+		dirs        = 100
+		filesPerDir = 1000 // 100k files total
+	)
+	fs := gofs.NewMemoryFs()
+	for i := 0; i < dirs; i++ {
+		dir := "/data/" + strconv.Itoa(i)
+		require.NoError(b, fs.MkdirAll(dir, 0777))
+		for j := 0; j < filesPerDir; j++ {
+			require.NoError(b, fs.WriteFile(dir+"/file."+strconv.Itoa(j), nil, 0666))
+		}
+	}
+	require.NoError(b, fs.MkdirAll("/small", 0777))
+	for j := 0; j < 10; j++ {
+		require.NoError(b, fs.WriteFile("/small/file."+strconv.Itoa(j), nil, 0666))
+	}
+
+	b.Run("stat", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = fs.Stat("/data/50/file.500")
+		}
+	})
+	b.Run("readDir small", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = fs.ReadDir("/small")
+		}
+	})
+	b.Run("rename", func(b *testing.B) {
+		b.ReportAllocs()
+		names := [2]string{"/small/file.0", "/small/renamed"}
+		for i := 0; i < b.N; i++ {
+			_ = fs.Rename(names[i%2], names[(i+1)%2])
+		}
+	})
+	b.Run("rename dir", func(b *testing.B) {
+		b.ReportAllocs()
+		names := [2]string{"/data/0", "/data/renamed"}
+		for i := 0; i < b.N; i++ {
+			_ = fs.Rename(names[i%2], names[(i+1)%2])
+		}
+	})
+	b.Run("removeAll small", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = fs.MkdirAll("/tmp/sub", 0777)
+			_ = fs.WriteFile("/tmp/sub/file", nil, 0666)
+			_ = fs.RemoveAll("/tmp")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitRot(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<20/16)
+	checksum := crc32.ChecksumIEEE(content)
+	newFs := func(t *testing.T, mode gofs.BitRotMode) (*gofs.InMemoryFS, *gofs.FakeClock) {
+		clock := gofs.NewFakeClock(time.Unix(0, 0))
+		fs := gofs.NewThreadSafeMemoryFs(gofs.WithClock(clock), gofs.WithBitRot(10, mode, rand.New(rand.NewSource(1))))
+		require.NoError(t, fs.WriteFile("/file", content, 0666))
+		return fs, clock
+	}
+	readFile := func(t *testing.T, fs *gofs.InMemoryFS) []byte {
+		data, err := fs.ReadFile("/file")
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("in storage", func(t *testing.T) {
+		fs, clock := newFs(t, gofs.BitRotInStorage)
+		require.Equal(t, checksum, crc32.ChecksumIEEE(readFile(t, fs)))
+
+		clock.Advance(time.Hour)
+		rotten := readFile(t, fs)
+		require.Len(t, rotten, len(content))
+		require.NotEqual(t, checksum, crc32.ChecksumIEEE(rotten))
+
+		// corruption is permanent
+		fs.SetBitRot(0, gofs.BitRotInStorage, nil)
+		clock.Advance(time.Hour)
+		require.Equal(t, rotten, readFile(t, fs))
+
+		// rewrite repairs
+		require.NoError(t, fs.WriteFile("/file", content, 0666))
+		require.Equal(t, content, readFile(t, fs))
+	})
+
+	t.Run("on read", func(t *testing.T) {
+		fs, clock := newFs(t, gofs.BitRotOnRead)
+		clock.Advance(time.Hour)
+		first := readFile(t, fs)
+		require.NotEqual(t, checksum, crc32.ChecksumIEEE(first))
+		second := readFile(t, fs)
+		require.NotEqual(t, checksum, crc32.ChecksumIEEE(second))
+		require.NotEqual(t, first, second)
+
+		// rewritten content is fresh
+		require.NoError(t, fs.WriteFile("/file", content, 0666))
+		require.Equal(t, content, readFile(t, fs))
+
+		// storage is intact
+		clock.Advance(time.Hour)
+		fs.SetBitRot(0, gofs.BitRotOnRead, nil)
+		require.Equal(t, content, readFile(t, fs))
+	})
+
+	t.Run("option order", func(t *testing.T) {
+		clock := gofs.NewFakeClock(time.Unix(0, 0))
+		fs := gofs.NewMemoryFs(gofs.WithBitRot(10, gofs.BitRotInStorage, rand.New(rand.NewSource(1))), gofs.WithClock(clock))
+		require.NoError(t, fs.WriteFile("/file", content, 0666))
+		clock.Advance(time.Hour)
+		require.NotEqual(t, checksum, crc32.ChecksumIEEE(readFile(t, fs)))
+	})
+
+	t.Run("default source", func(t *testing.T) {
+		fs, clock := newFs(t, gofs.BitRotOnRead)
+		fs.SetBitRot(10, gofs.BitRotOnRead, nil)
+		clock.Advance(time.Hour)
+		require.NotEqual(t, checksum, crc32.ChecksumIEEE(readFile(t, fs)))
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		fs, clock := newFs(t, gofs.BitRotInStorage)
+		clock.Advance(100 * time.Hour)
+		rotten := readFile(t, fs)
+		flips := 0
+		for i := range content {
+			for d := content[i] ^ rotten[i]; d != 0; d &= d - 1 {
+				flips++
+			}
+		}
+		require.InDelta(t, 1000, flips, 150)
+	})
+
+	t.Run("crash keeps rot", func(t *testing.T) {
+		fs, clock := newFs(t, gofs.BitRotInStorage)
+		fs.TrackDirtyPages()
+		clock.Advance(time.Hour)
+		rotten := readFile(t, fs)
+		fs.Crash(rand.New(rand.NewSource(1)))
+		require.Equal(t, rotten, readFile(t, fs))
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		fs, clock := newFs(t, gofs.BitRotOnRead)
+		clock.Advance(time.Hour)
+		fp, err := fs.OpenFile("/file", os.O_RDWR, 0)
+		require.NoError(t, err)
+		require.NoError(t, fp.Truncate(1<<10))
+		require.NoError(t, fp.Close())
+		require.Equal(t, content[:1<<10], readFile(t, fs))
+	})
+}
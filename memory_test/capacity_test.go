@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func requireNoSpace(t *testing.T, err error) {
+	t.Helper()
+	var pathErr *os.PathError
+	require.True(t, errors.As(err, &pathErr), "%v", err)
+	require.True(t, errors.Is(err, syscall.ENOSPC), "%v", err)
+}
+
+func TestCapacity(t *testing.T) {
+	t.Run("bytes", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCapacity(10, 0))
+		fp, err := fs.Create("/wal")
+		require.NoError(t, err)
+		n, err := fp.Write([]byte("123456"))
+		require.NoError(t, err)
+		require.Equal(t, 6, n)
+
+		// write is cut at the capacity
+		n, err = fp.Write([]byte("789abc"))
+		requireNoSpace(t, err)
+		require.Equal(t, 4, n)
+		n, err = fp.Write([]byte("d"))
+		requireNoSpace(t, err)
+		require.Equal(t, 0, n)
+		data, err := fs.ReadFile("/wal")
+		require.NoError(t, err)
+		require.Equal(t, "123456789a", string(data))
+
+		// overwrite does not need new space
+		_, err = fp.WriteAt([]byte("xyz"), 0)
+		require.NoError(t, err)
+
+		st, err := fs.Statfs("/wal")
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), st.TotalBytes)
+		require.Equal(t, uint64(0), st.FreeBytes)
+
+		requireNoSpace(t, fp.Truncate(11))
+		require.NoError(t, fp.Truncate(4))
+		requireNoSpace(t, fs.Truncate("/wal", 20))
+		require.NoError(t, fs.Truncate("/wal", 10))
+		require.NoError(t, fp.Truncate(0))
+
+		// space of removed file is reclaimed on last close
+		_, err = fp.WriteAt([]byte("12345"), 0)
+		require.NoError(t, err)
+		require.NoError(t, fs.Remove("/wal"))
+		requireNoSpace(t, fs.WriteFile("/other", []byte("123456"), 0666))
+		require.NoError(t, fp.Close())
+		require.NoError(t, fs.WriteFile("/other", []byte("123456"), 0666))
+
+		fs.SetCapacity(0, 0)
+		require.NoError(t, fs.WriteFile("/other", make([]byte, 1000), 0666))
+	})
+
+	t.Run("inodes", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCapacity(0, 3))
+		st, err := fs.Statfs("/")
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), st.TotalInodes)
+		require.Equal(t, uint64(2), st.FreeInodes)
+
+		require.NoError(t, fs.Mkdir("/dir", 0777))
+		require.NoError(t, fs.WriteFile("/dir/file", nil, 0666))
+		require.NoError(t, fs.Link("/dir/file", "/link"))
+		requireNoSpace(t, fs.WriteFile("/file", nil, 0666))
+		requireNoSpace(t, fs.Mkdir("/dir2", 0777))
+		require.Error(t, fs.Symlink("/dir", "/symlink"))
+		_, err = fs.Stat("/file")
+		require.True(t, os.IsNotExist(err))
+
+		require.NoError(t, fs.RemoveAll("/dir"))
+		require.NoError(t, fs.Mkdir("/dir2", 0777))
+		requireNoSpace(t, fs.Mkdir("/dir3", 0777))
+		require.NoError(t, fs.Remove("/link"))
+		require.NoError(t, fs.Mkdir("/dir3", 0777))
+	})
+
+	t.Run("statfs", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		st, err := fs.Statfs("/")
+		require.NoError(t, err)
+		require.Greater(t, st.FreeBytes, uint64(0))
+		_, err = fs.Statfs("/not_exist")
+		require.True(t, os.IsNotExist(err))
+
+		st, err = gofs.OsFs().Statfs(t.TempDir())
+		require.NoError(t, err)
+		require.Greater(t, st.TotalBytes, uint64(0))
+		require.LessOrEqual(t, st.FreeBytes, st.TotalBytes)
+		_, err = gofs.OsFs().Statfs("/not_exist")
+		require.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrash(t *testing.T) {
+	const sector = 512
+
+	t.Run("synced data survives", func(t *testing.T) {
+		seenOld, seenNew := false, false
+		for seed := int64(0); seed < 20; seed++ {
+			fs := gofs.NewMemoryFs()
+			fs.TrackDirtyPages()
+			fp, err := fs.Create("/file")
+			require.NoError(t, err)
+			_, err = fp.Write(bytes.Repeat([]byte("a"), 4*sector))
+			require.NoError(t, err)
+			require.NoError(t, fp.Sync())
+			syncDir(t, fs, "/")
+			_, err = fp.WriteAt(bytes.Repeat([]byte("b"), 4*sector), 0)
+			require.NoError(t, err)
+
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			_, err = fp.Write([]byte("x"))
+			require.ErrorIs(t, err, os.ErrInvalid)
+			require.Equal(t, 0, fs.OpenHandles())
+
+			data, err := fs.ReadFile("/file")
+			require.NoError(t, err)
+			require.Len(t, data, 4*sector)
+			for i := 0; i < len(data); i += sector {
+				s := data[i : i+sector]
+				switch {
+				case bytes.Equal(s, bytes.Repeat([]byte("a"), sector)):
+					seenOld = true
+				case bytes.Equal(s, bytes.Repeat([]byte("b"), sector)):
+					seenNew = true
+				default:
+					t.Fatalf("torn sector at %d", i)
+				}
+			}
+		}
+		require.True(t, seenOld)
+		require.True(t, seenNew)
+	})
+
+	t.Run("not synced size", func(t *testing.T) {
+		sizes := map[int]bool{}
+		for seed := int64(0); seed < 20; seed++ {
+			fs := gofs.NewMemoryFs()
+			fs.TrackDirtyPages()
+			require.NoError(t, fs.WriteFile("/file", bytes.Repeat([]byte("a"), 1000), 0666))
+			syncDir(t, fs, "/")
+			fs.Crash(rand.New(rand.NewSource(seed)))
+
+			data, err := fs.ReadFile("/file")
+			require.NoError(t, err)
+			sizes[len(data)] = true
+			for i, c := range data {
+				require.True(t, c == 0 || c == 'a', "unexpected byte at %d", i)
+			}
+		}
+		require.Equal(t, map[int]bool{0: true, 1000: true}, sizes)
+	})
+
+	t.Run("synced truncate", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		fs.TrackDirtyPages()
+		fp, err := fs.Create("/file")
+		require.NoError(t, err)
+		_, err = fp.Write([]byte("old content"))
+		require.NoError(t, err)
+		require.NoError(t, fp.Truncate(0))
+		_, err = fp.WriteAt([]byte("new"), 0)
+		require.NoError(t, err)
+		require.NoError(t, fp.Sync())
+		syncDir(t, fs, "/")
+
+		fs.Crash(rand.New(rand.NewSource(1)))
+		data, err := fs.ReadFile("/file")
+		require.NoError(t, err)
+		require.Equal(t, "new", string(data))
+	})
+
+	t.Run("reproducible", func(t *testing.T) {
+		run := func(seed int64) string {
+			fs := gofs.NewMemoryFs()
+			fs.TrackDirtyPages()
+			for i := 0; i < 10; i++ {
+				require.NoError(t, fs.WriteFile(fmt.Sprintf("/file%d", i), bytes.Repeat([]byte{'a' + byte(i)}, 3*sector), 0666))
+			}
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			var state bytes.Buffer
+			for i := 0; i < 10; i++ {
+				data, err := fs.ReadFile(fmt.Sprintf("/file%d", i))
+				if os.IsNotExist(err) {
+					data, err = []byte("missing"), nil
+				}
+				require.NoError(t, err)
+				state.Write(data)
+				state.WriteByte('|')
+			}
+			return state.String()
+		}
+		require.Equal(t, run(7), run(7))
+	})
+
+	t.Run("without tracking", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCapacity(100, 0))
+		fp, err := fs.Create("/file")
+		require.NoError(t, err)
+		_, err = fp.Write([]byte("data"))
+		require.NoError(t, err)
+		removed, err := fs.Create("/removed")
+		require.NoError(t, err)
+		_, err = removed.Write(make([]byte, 90))
+		require.NoError(t, err)
+		require.NoError(t, fs.Remove("/removed"))
+
+		fs.Crash(rand.New(rand.NewSource(1)))
+		require.Error(t, fp.Close())
+		data, err := fs.ReadFile("/file")
+		require.NoError(t, err)
+		require.Equal(t, "data", string(data))
+		st, err := fs.Statfs("/")
+		require.NoError(t, err)
+		require.Equal(t, uint64(96), st.FreeBytes)
+	})
+}
+
+func syncDir(t *testing.T, fs *gofs.InMemoryFS, path string) {
+	t.Helper()
+	dir, err := fs.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, dir.Sync())
+	require.NoError(t, dir.Close())
+}
@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultFS(t *testing.T) {
+	backends := map[string]func(t *testing.T) (gofs.FS, string){
+		"memory": func(t *testing.T) (gofs.FS, string) {
+			return gofs.NewMemoryFs(), "/"
+		},
+		"os": func(t *testing.T) (gofs.FS, string) {
+			return gofs.OsFs(), t.TempDir()
+		},
+	}
+	for name, newFs := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Run("op and path", func(t *testing.T) {
+				inner, dir := newFs(t)
+				fs := gofs.NewFaultFS(inner, nil)
+				logPath := filepath.Join(dir, "app.log")
+				id := fs.AddRule(gofs.FaultRule{Op: "OpenFile", Path: filepath.Join(dir, "*.log"), Err: syscall.EACCES})
+
+				_, err := fs.OpenFile(logPath, os.O_CREATE|os.O_RDWR, 0666)
+				var pathErr *os.PathError
+				require.True(t, errors.As(err, &pathErr))
+				require.Equal(t, logPath, pathErr.Path)
+				require.True(t, errors.Is(err, syscall.EACCES))
+				_, err = inner.Stat(logPath)
+				require.True(t, os.IsNotExist(err), "failed operation should not reach wrapped fs")
+
+				fp, err := fs.OpenFile(filepath.Join(dir, "app.txt"), os.O_CREATE|os.O_RDWR, 0666)
+				require.NoError(t, err)
+				require.NoError(t, fp.Close())
+
+				fs.RemoveRule(id)
+				fp, err = fs.OpenFile(logPath, os.O_CREATE|os.O_RDWR, 0666)
+				require.NoError(t, err)
+				require.NoError(t, fp.Close())
+
+				fs.AddRule(gofs.FaultRule{Op: "Rename", Path: logPath})
+				err = fs.Rename(filepath.Join(dir, "app.txt"), logPath)
+				var linkErr *os.LinkError
+				require.True(t, errors.As(err, &linkErr))
+				require.True(t, errors.Is(err, syscall.EIO))
+			})
+
+			t.Run("nth call", func(t *testing.T) {
+				inner, dir := newFs(t)
+				fs := gofs.NewFaultFS(inner, nil)
+				fp, err := fs.Create(filepath.Join(dir, "wal"))
+				require.NoError(t, err)
+				fs.AddRule(gofs.FaultRule{Op: "Write", Nth: 2, Err: syscall.ENOSPC})
+
+				_, err = fp.Write([]byte("first"))
+				require.NoError(t, err)
+				_, err = fp.WriteString("second")
+				require.True(t, errors.Is(err, syscall.ENOSPC))
+				_, err = io.WriteString(fp, "third")
+				require.NoError(t, err)
+
+				fs.AddRule(gofs.FaultRule{Op: "Sync", Err: syscall.EIO})
+				require.True(t, errors.Is(fp.Sync(), syscall.EIO))
+
+				// file is closed even if close fails
+				fs.AddRule(gofs.FaultRule{Op: "Close", Err: syscall.EINTR})
+				require.True(t, errors.Is(fp.Close(), syscall.EINTR))
+				fs.ClearRules()
+				require.Error(t, fp.Close())
+
+				data, err := fs.ReadFile(filepath.Join(dir, "wal"))
+				require.NoError(t, err)
+				require.Equal(t, "firstthird", string(data))
+			})
+
+			t.Run("offset range", func(t *testing.T) {
+				inner, dir := newFs(t)
+				fs := gofs.NewFaultFS(inner, nil)
+				fp, err := fs.Create(filepath.Join(dir, "data"))
+				require.NoError(t, err)
+				_, err = fp.Write(make([]byte, 100))
+				require.NoError(t, err)
+				fs.AddRule(gofs.FaultRule{Op: "ReadAt", OffsetFrom: 50, OffsetTo: 60})
+				fs.AddRule(gofs.FaultRule{Op: "Read", OffsetFrom: 50, OffsetTo: 60})
+
+				buf := make([]byte, 10)
+				_, err = fp.ReadAt(buf, 40)
+				require.NoError(t, err)
+				_, err = fp.ReadAt(buf, 45)
+				require.True(t, errors.Is(err, syscall.EIO))
+				_, err = fp.ReadAt(buf, 60)
+				require.NoError(t, err)
+
+				_, err = fp.Seek(41, io.SeekStart)
+				require.NoError(t, err)
+				_, err = fp.Read(buf[:9])
+				require.NoError(t, err)
+				_, err = fp.Read(buf)
+				require.True(t, errors.Is(err, syscall.EIO))
+				require.NoError(t, fp.Close())
+			})
+		})
+	}
+
+	t.Run("probability is reproducible", func(t *testing.T) {
+		failures := func(seed int64) []bool {
+			fs := gofs.NewFaultFS(gofs.NewMemoryFs(), rand.New(rand.NewSource(seed)))
+			fs.AddRule(gofs.FaultRule{Op: "Mkdir", Probability: 0.5})
+			var ret []bool
+			for i := 0; i < 100; i++ {
+				ret = append(ret, fs.Mkdir("/dir", 0777) != nil)
+				_ = fs.Remove("/dir")
+			}
+			return ret
+		}
+		first := failures(42)
+		require.Equal(t, first, failures(42))
+		require.Contains(t, first, true)
+		require.Contains(t, first, false)
+	})
+}
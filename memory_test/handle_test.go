@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenHandle(t *testing.T) {
+	t.Run("write after remove", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		fp, err := fs.OpenFile("/app.log", os.O_RDWR|os.O_CREATE, 0666)
+		require.NoError(t, err)
+		_, err = fp.WriteString("before ")
+		require.NoError(t, err)
+
+		// log rotation
+		require.NoError(t, fs.Remove("/app.log"))
+		require.NoError(t, fs.WriteFile("/app.log", []byte("new"), 0666))
+		_, err = fp.WriteString("after")
+		require.NoError(t, err)
+
+		_, err = fp.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		data, err := io.ReadAll(fp)
+		require.NoError(t, err)
+		require.Equal(t, "before after", string(data))
+		fi, err := fp.Stat()
+		require.NoError(t, err)
+		require.Equal(t, int64(len("before after")), fi.Size())
+
+		data, err = fs.ReadFile("/app.log")
+		require.NoError(t, err)
+		require.Equal(t, "new", string(data))
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("follows rename", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/a/sub", 0777))
+		fp, err := fs.Create("/a/file")
+		require.NoError(t, err)
+		dir, err := fs.Open("/a/sub")
+		require.NoError(t, err)
+
+		require.NoError(t, fs.Rename("/a", "/b"))
+		_, err = fp.WriteString("data")
+		require.NoError(t, err)
+		data, err := fs.ReadFile("/b/file")
+		require.NoError(t, err)
+		require.Equal(t, "data", string(data))
+
+		require.NoError(t, dir.Chdir())
+		_, err = fs.Stat("../file")
+		require.NoError(t, err)
+		require.NoError(t, fs.WriteFile("rel", nil, 0666))
+		_, err = fs.Stat("/b/sub/rel")
+		require.NoError(t, err)
+
+		require.NoError(t, fp.Close())
+		require.NoError(t, dir.Close())
+	})
+
+	t.Run("open handles count", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.Equal(t, 0, fs.OpenHandles())
+		fp1, err := fs.Create("/a")
+		require.NoError(t, err)
+		fp2, err := fs.Open("/a")
+		require.NoError(t, err)
+		require.Equal(t, 2, fs.OpenHandles())
+
+		require.NoError(t, fs.Remove("/a"))
+		require.Equal(t, 2, fs.OpenHandles())
+		require.NoError(t, fp1.Close())
+		require.Error(t, fp1.Close())
+		require.Equal(t, 1, fs.OpenHandles())
+		require.NoError(t, fp2.Close())
+		require.Equal(t, 0, fs.OpenHandles())
+
+		// helpers close files they open
+		require.NoError(t, fs.WriteFile("/b", []byte("data"), 0666))
+		_, err = fs.ReadFile("/b")
+		require.NoError(t, err)
+		_, err = fs.ReadDir("/")
+		require.NoError(t, err)
+		require.Equal(t, 0, fs.OpenHandles())
+	})
+}
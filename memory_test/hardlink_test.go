@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHardLink(t *testing.T) {
+	t.Run("shared content", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/a", []byte("hello"), 0666))
+		require.NoError(t, fs.Link("/a", "/b"))
+
+		fp, err := fs.OpenFile("/b", os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = fp.WriteString(" world")
+		require.NoError(t, err)
+		require.NoError(t, fp.Close())
+
+		data, err := fs.ReadFile("/a")
+		require.NoError(t, err)
+		require.Equal(t, "hello world", string(data))
+
+		fi, err := fs.Stat("/a")
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), nlink(t, fi))
+
+		_, err = fs.ReadDir("/")
+		require.NoError(t, err)
+		require.True(t, os.IsExist(fs.Link("/a", "/b")))
+	})
+
+	t.Run("remove keeps content while linked or open", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/a", []byte("data"), 0666))
+		require.NoError(t, fs.Link("/a", "/b"))
+		fp, err := fs.Open("/b")
+		require.NoError(t, err)
+
+		require.NoError(t, fs.Remove("/a"))
+		require.NoError(t, fs.Remove("/b"))
+		fi, err := fp.Stat()
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), nlink(t, fi))
+
+		// new files must not reuse memory of the removed, but still open file
+		require.NoError(t, fs.WriteFile("/c", []byte("other"), 0666))
+		data, err := io.ReadAll(fp)
+		require.NoError(t, err)
+		require.Equal(t, "data", string(data))
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("directory link count", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/a/b", 0777))
+		require.NoError(t, fs.Mkdir("/a/c", 0777))
+		fi, err := fs.Stat("/a")
+		require.NoError(t, err)
+		require.Equal(t, uint64(4), nlink(t, fi))
+
+		err = fs.Link("/a", "/d")
+		require.ErrorIs(t, err, syscall.EPERM)
+	})
+}
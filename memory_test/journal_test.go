@@ -0,0 +1,205 @@
+package memory
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceCrash(t *testing.T) {
+	t.Run("create needs directory sync", func(t *testing.T) {
+		seen := map[bool]bool{}
+		for seed := int64(0); seed < 20; seed++ {
+			fs := gofs.NewMemoryFs(gofs.WithCapacity(0, 10))
+			fs.TrackDirtyPages()
+			require.NoError(t, fs.Mkdir("/dir", 0777))
+			syncDir(t, fs, "/")
+			fp, err := fs.Create("/dir/file")
+			require.NoError(t, err)
+			_, err = fp.Write([]byte("data"))
+			require.NoError(t, err)
+			require.NoError(t, fp.Sync())
+
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			data, err := fs.ReadFile("/dir/file")
+			exists := !os.IsNotExist(err)
+			seen[exists] = true
+			if exists {
+				require.NoError(t, err)
+				require.Equal(t, "data", string(data))
+			}
+			st, err := fs.Statfs("/")
+			require.NoError(t, err)
+			used := 2
+			if exists {
+				used = 3
+			}
+			require.Equal(t, uint64(10-used), st.FreeInodes)
+		}
+		require.Equal(t, map[bool]bool{false: true, true: true}, seen)
+
+		fs := gofs.NewMemoryFs()
+		fs.TrackDirtyPages()
+		require.NoError(t, fs.Mkdir("/dir", 0777))
+		require.NoError(t, fs.WriteFile("/dir/file", []byte("data"), 0666))
+		// sync of parent directory is not enough for new file in subdirectory
+		syncDir(t, fs, "/")
+		syncDir(t, fs, "/dir")
+		fs.Crash(rand.New(rand.NewSource(1)))
+		_, err := fs.Stat("/dir/file")
+		require.NoError(t, err)
+	})
+
+	t.Run("remove is undone", func(t *testing.T) {
+		seen := map[bool]bool{}
+		for seed := int64(0); seed < 20; seed++ {
+			fs := gofs.NewMemoryFs(gofs.WithCapacity(100, 0))
+			fs.TrackDirtyPages()
+			writeSynced(t, fs, "/file", "data")
+			require.NoError(t, fs.Link("/file", "/link"))
+			require.NoError(t, fs.Mkdir("/dir", 0777))
+			syncDir(t, fs, "/")
+			require.NoError(t, fs.Remove("/file"))
+			require.NoError(t, fs.Remove("/link"))
+			require.NoError(t, fs.Remove("/dir"))
+
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			data, err := fs.ReadFile("/link")
+			exists := !os.IsNotExist(err)
+			seen[exists] = true
+			st, err := fs.Statfs("/")
+			require.NoError(t, err)
+			if exists {
+				require.Equal(t, "data", string(data))
+				require.Equal(t, uint64(96), st.FreeBytes)
+			} else {
+				require.Equal(t, uint64(100), st.FreeBytes)
+			}
+			if _, err := fs.Stat("/dir"); os.IsNotExist(err) {
+				// removals reach disk in order
+				require.False(t, exists)
+			}
+		}
+		require.Equal(t, map[bool]bool{false: true, true: true}, seen)
+	})
+
+	t.Run("rename is atomic", func(t *testing.T) {
+		seen := map[string]bool{}
+		for seed := int64(0); seed < 20; seed++ {
+			fs := gofs.NewMemoryFs()
+			fs.TrackDirtyPages()
+			require.NoError(t, fs.MkdirAll("/a/sub", 0777))
+			writeSynced(t, fs, "/a/sub/file", "data")
+			require.NoError(t, fs.Mkdir("/b", 0777))
+			require.NoError(t, fs.WriteFile("/b/a", nil, 0666))
+			syncDir(t, fs, "/")
+			syncDir(t, fs, "/a")
+			syncDir(t, fs, "/a/sub")
+			syncDir(t, fs, "/b")
+			require.NoError(t, fs.Rename("/a", "/c"))
+			require.NoError(t, fs.Rename("/b/a", "/a"))
+
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			entries, err := fs.ReadDir("/")
+			require.NoError(t, err)
+			var names string
+			for _, e := range entries {
+				names += e.Name()
+			}
+			seen[names] = true
+			_, err = fs.Stat("/b/a")
+			require.Equal(t, names == "abc", os.IsNotExist(err))
+			data, err := fs.ReadFile("/c/sub/file")
+			if names == "ab" {
+				data, err = fs.ReadFile("/a/sub/file")
+			}
+			require.NoError(t, err)
+			require.Equal(t, "data", string(data))
+		}
+		require.Equal(t, map[string]bool{"ab": true, "bc": true, "abc": true}, seen)
+	})
+
+	t.Run("atomic save", func(t *testing.T) {
+		save := func(fs *gofs.InMemoryFS, content string, syncFile, syncParent bool) {
+			fp, err := fs.Create("/config.tmp")
+			require.NoError(t, err)
+			_, err = fp.WriteString(content)
+			require.NoError(t, err)
+			if syncFile {
+				require.NoError(t, fp.Sync())
+			}
+			require.NoError(t, fp.Close())
+			require.NoError(t, fs.Rename("/config.tmp", "/config"))
+			if syncParent {
+				syncDir(t, fs, "/")
+			}
+		}
+		results := func(syncFile, syncParent bool) map[string]bool {
+			ret := map[string]bool{}
+			for seed := int64(0); seed < 30; seed++ {
+				fs := gofs.NewMemoryFs()
+				fs.TrackDirtyPages()
+				save(fs, "old", true, true)
+				save(fs, "new", syncFile, syncParent)
+				fs.Crash(rand.New(rand.NewSource(seed)))
+				data, err := fs.ReadFile("/config")
+				require.NoError(t, err)
+				ret[string(data)] = true
+			}
+			return ret
+		}
+
+		require.Equal(t, map[string]bool{"new": true}, results(true, true))
+		require.Equal(t, map[string]bool{"old": true, "new": true}, results(true, false))
+		require.Contains(t, results(false, true), "")
+	})
+
+	t.Run("removed file releases space", func(t *testing.T) {
+		for seed := int64(0); seed < 10; seed++ {
+			fs := gofs.NewMemoryFs(gofs.WithCapacity(1000, 0))
+			fs.TrackDirtyPages()
+			writeSynced(t, fs, "/old", string(make([]byte, 600)))
+			syncDir(t, fs, "/")
+			require.NoError(t, fs.Remove("/old"))
+			st, err := fs.Statfs("/")
+			require.NoError(t, err)
+			require.Equal(t, uint64(1000), st.FreeBytes)
+			writeSynced(t, fs, "/new", string(make([]byte, 600)))
+
+			// undone removal charges the space again, even above capacity
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			var used int64
+			for _, name := range []string{"/old", "/new"} {
+				if fi, err := fs.Stat(name); err == nil {
+					used += fi.Size()
+				}
+			}
+			st, err = fs.Statfs("/")
+			require.NoError(t, err)
+			require.Equal(t, uint64(max(1000-used, 0)), st.FreeBytes)
+		}
+	})
+
+	t.Run("sync of closed directory", func(t *testing.T) {
+		fs := gofs.NewThreadSafeMemoryFs()
+		fs.TrackDirtyPages()
+		dir, err := fs.Open("/")
+		require.NoError(t, err)
+		require.NoError(t, dir.Close())
+		require.ErrorIs(t, dir.Sync(), os.ErrInvalid)
+	})
+}
+
+// writeSynced creates file with durable content, but not durable name
+func writeSynced(t *testing.T, fs *gofs.InMemoryFS, name, content string) {
+	t.Helper()
+	fp, err := fs.Create(name)
+	require.NoError(t, err)
+	_, err = fp.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, fp.Sync())
+	require.NoError(t, fp.Close())
+}
@@ -10,7 +10,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"slices"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/myxo/gofs"
 
@@ -56,6 +58,28 @@ func listOsFiles(dirPath string) {
 }
 */
 
+// renameOs is os.Rename with kernel semantics. os.Rename refuses to replace any existing directory
+// with EEXIST before calling rename(2), while fake follows posix.
+func renameOs(oldpath, newpath string) error {
+	if fi, err := os.Lstat(newpath); err == nil && fi.IsDir() {
+		return syscall.Rename(oldpath, newpath)
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// restoreDirPerms makes directory tree accessible again, so it can be removed
+func restoreDirPerms(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.IsDir() {
+		return
+	}
+	_ = os.Chmod(path, 0777)
+	entries, _ := os.ReadDir(path)
+	for _, e := range entries {
+		restoreDirPerms(filepath.Join(path, e.Name()))
+	}
+}
+
 func TestFS(t *testing.T) {
 	dir := t.TempDir()
 
@@ -63,10 +87,30 @@ func TestFS(t *testing.T) {
 	var memStat runtime.MemStats
 	runtime.ReadMemStats(&memStat)
 
+	groups, err := os.Getgroups()
+	require.NoError(t, err)
+	credentials := gofs.WithCredentials(os.Geteuid(), os.Getegid(), groups...)
+	umask := processUmask()
+
 	rapid.Check(t, func(t *rapid.T) {
-		fs := &statFs{fs: gofs.NewMemoryFs()}
-		possibleFilenames := []string{"/foo/a/test.file.1", "/foo/a/test.file.2", "/foo/b/test.file.1", "/foo/b/test.file.2"}
-		possibleDirs := []string{"/foo", "/foo/a", "/foo/b"}
+		fs := &statFs{fs: gofs.NewMemoryFs(credentials, gofs.WithUmask(umask))}
+		possibleFilenames := []string{
+			"/foo/a/test.file.1", "/foo/a/test.file.2", "/foo/b/test.file.1", "/foo/b/test.file.2",
+			"/foo/flink.1", "/foo/a/flink.2", "/foo/dlink/test.file.1",
+		}
+		possibleDirs := []string{"/foo", "/foo/a", "/foo/b", "/foo/dlink"}
+		// links from possibleFilenames should point only to files (or nowhere), since os behaviour
+		// of directory descriptors differ a lot from ours (e.g. seek)
+		possibleFileLinks := []string{"/foo/flink.1", "/foo/a/flink.2"}
+		possibleFileLinkTargets := []string{
+			"test.file.1", "a/test.file.2", "../b/test.file.1", "/foo/a/test.file.1",
+			"flink.1", "a/flink.2", "../flink.1", "nonexistent", "/foo/nonexistent",
+		}
+		possibleDirLinkTargets := []string{"a", "b", "/foo/a", "dlink", "nonexistent"}
+		// paths, that refer to the entry itself or to directory, to check how the last component is resolved
+		slashedLinks := []string{"/foo/flink.1/", "/foo/a/flink.2/", "/foo/dlink/"}
+		dotPaths := []string{"/foo/a/.", "/foo/dlink/.", "/foo/flink.1/.", "/foo/a/test.file.1/.", "/foo/nonexistent/."}
+		entryPaths := append(slices.Clone(slashedLinks), dotPaths...)
 		var osFiles []*gofs.File
 		var fakeFiles []*statFile
 		workDir := "/"
@@ -77,7 +121,12 @@ func TestFS(t *testing.T) {
 			for i := range osFiles {
 				osFiles[i].Close()
 			}
-			_ = os.RemoveAll(filepath.Join(dir, "foo"))
+			// links may create files outside of foo, so clean up whole dir
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				restoreDirPerms(filepath.Join(dir, e.Name()))
+				_ = os.RemoveAll(filepath.Join(dir, e.Name()))
+			}
 			fs.fs.Release()
 		}()
 
@@ -121,6 +170,20 @@ func TestFS(t *testing.T) {
 			return osP, fakeP
 		}
 
+		// getOddPaths returns one of paths as is, since filepath.Join drops trailing slash and "." component
+		getOddPaths := func(paths []string) (string, string) {
+			p := rapid.SampledFrom(paths).Draw(t, "odd path")
+			return dir + p, p
+		}
+
+		getLinkTarget := func(targets []string) (string, string) {
+			p := rapid.SampledFrom(targets).Draw(t, "link target")
+			if filepath.IsAbs(p) {
+				return filepath.Join(dir, p), p
+			}
+			return p, p
+		}
+
 		t.Repeat(map[string]func(*rapid.T){
 			"write": func(t *rapid.T) {
 				fpOs, fpFake := getFiles()
@@ -172,14 +235,24 @@ func TestFS(t *testing.T) {
 			},
 			"Chmod": func(t *rapid.T) {
 				// we do not check execute permission
-				// we do not check permission for different user groups
-				possibleModes := []os.FileMode{0666, 0222, 0444} // rw, w-only, r-only
+				// rw, w-only, r-only, per user group, and special bits with and without group execute
+				possibleModes := []os.FileMode{
+					0666, 0222, 0444, 0600, 0060, 0006, os.ModeSetuid | 0666, os.ModeSetgid | 0666, os.ModeSetgid | 0676,
+				}
 				fpOs, fpFake := getFiles()
 				mode := rapid.SampledFrom(possibleModes).Draw(t, "file mode")
 				errOs := fpOs.Chmod(mode)
 				errFake := fpFake.Chmod(mode)
 				checkSyncError(t, errOs, errFake)
 			},
+			"Chown": func(t *rapid.T) {
+				fpOs, fpFake := getFiles()
+				uid := rapid.SampledFrom([]int{-1, os.Geteuid(), 12345}).Draw(t, "uid")
+				gid := rapid.SampledFrom([]int{-1, os.Getegid(), 12345}).Draw(t, "gid")
+				errOs := fpOs.Chown(uid, gid)
+				errFake := fpFake.Chown(uid, gid)
+				checkSyncError(t, errOs, errFake)
+			},
 			"Chdir": func(t *rapid.T) {
 				fpOs, fpFake := getFiles()
 				errOs := fpOs.Chdir()
@@ -301,7 +374,7 @@ func TestFS(t *testing.T) {
 			},
 			"FS_OpenFile": func(t *rapid.T) {
 				osPath, fakePath := getFilePaths()
-				possibleModes := []os.FileMode{0666, 0222, 0444} // rw, w-only, r-only
+				possibleModes := []os.FileMode{0666, 0222, 0444, 0600, 0060, 0006} // rw, w-only, r-only, and per user group
 				perm := rapid.SampledFrom(possibleModes).Draw(t, "file perm")
 				flagMap := map[string]int{"readonly": os.O_RDONLY, "writeonly": os.O_WRONLY, "RDWR": os.O_RDWR}
 				possibleFlags := []string{"readonly", "writeonly", "RDWR"}
@@ -335,14 +408,47 @@ func TestFS(t *testing.T) {
 			},
 			"FS_Chmod": func(t *rapid.T) {
 				osPath, fakePath := getFilePaths()
-				possibleModes := []os.FileMode{0666, 0222, 0444} // rw, w-only, r-only
+				// rw, w-only, r-only, per user group, and special bits with and without group execute
+				possibleModes := []os.FileMode{
+					0666, 0222, 0444, 0600, 0060, 0006, os.ModeSetuid | 0666, os.ModeSetgid | 0666, os.ModeSetgid | 0676,
+				}
 				mode := rapid.SampledFrom(possibleModes).Draw(t, "file mode")
 				errOs := os.Chmod(osPath, mode)
 				errFake := fs.Chmod(fakePath, mode)
 				checkSyncError(t, errOs, errFake)
 			},
+			"FS_ChmodDir": func(t *rapid.T) {
+				osPath, fakePath := getDirPaths()
+				// full, no write, no read, no search, per user group, and special bits
+				possibleModes := []os.FileMode{
+					0777, 0555, 0333, 0666, 0700, 0070, 0007, os.ModeSticky | 0777, os.ModeSetgid | 0777,
+				}
+				mode := rapid.SampledFrom(possibleModes).Draw(t, "dir mode")
+				errOs := os.Chmod(osPath, mode)
+				errFake := fs.Chmod(fakePath, mode)
+				checkSyncError(t, errOs, errFake)
+			},
+			"FS_Chown": func(t *rapid.T) {
+				osPath, fakePath := getFilePaths()
+				uid := rapid.SampledFrom([]int{-1, os.Geteuid(), 12345}).Draw(t, "uid")
+				gid := rapid.SampledFrom([]int{-1, os.Getegid(), 12345}).Draw(t, "gid")
+				if rapid.Bool().Draw(t, "lchown") {
+					checkSyncError(t, os.Lchown(osPath, uid, gid), fs.Lchown(fakePath, uid, gid))
+				} else {
+					checkSyncError(t, os.Chown(osPath, uid, gid), fs.Chown(fakePath, uid, gid))
+				}
+			},
+			"FS_ChownDir": func(t *rapid.T) {
+				osPath, fakePath := getDirPaths()
+				uid := rapid.SampledFrom([]int{-1, os.Geteuid(), 12345}).Draw(t, "uid")
+				gid := rapid.SampledFrom([]int{-1, os.Getegid(), 12345}).Draw(t, "gid")
+				checkSyncError(t, os.Chown(osPath, uid, gid), fs.Chown(fakePath, uid, gid))
+			},
 			"FS_Mkdir": func(t *rapid.T) {
 				osPath, fakePath := getDirPaths()
+				if rapid.Bool().Draw(t, "dot path") {
+					osPath, fakePath = getOddPaths(dotPaths)
+				}
 				errOs := os.Mkdir(osPath, 0777)
 				errFake := fs.Mkdir(fakePath, 0777)
 				checkSyncError(t, errOs, errFake)
@@ -363,6 +469,9 @@ func TestFS(t *testing.T) {
 			"FS_Remove": func(t *rapid.T) {
 				// TODO: remove also dirs and subdirs
 				osPath, fakePath := getFilePaths()
+				if rapid.Bool().Draw(t, "odd path") {
+					osPath, fakePath = getOddPaths(entryPaths)
+				}
 				errOs := os.Remove(osPath)
 				errFake := fs.Remove(fakePath)
 				checkSyncError(t, errOs, errFake)
@@ -370,15 +479,33 @@ func TestFS(t *testing.T) {
 			"FS_RemoveAll": func(t *rapid.T) {
 				// TODO: remove also dirs and subdirs
 				osPath, fakePath := getFilePaths()
+				if rapid.Bool().Draw(t, "odd path") {
+					osPath, fakePath = getOddPaths(entryPaths)
+				}
 				errOs := os.RemoveAll(osPath)
 				errFake := fs.RemoveAll(fakePath)
 				checkSyncError(t, errOs, errFake)
 			},
 			"FS_Rename": func(t *rapid.T) {
+				// dlink may be a directory, which should not be moved to file paths
 				oldOsPath, oldFakePath := getFilePaths()
+				if rapid.Bool().Draw(t, "odd old path") {
+					oldOsPath, oldFakePath = getOddPaths(entryPaths[:2])
+				}
 				newOsPath, newFakePath := getFilePaths()
+				if rapid.Bool().Draw(t, "odd new path") {
+					newOsPath, newFakePath = getOddPaths(entryPaths)
+				}
 
-				errOs := os.Rename(oldOsPath, newOsPath)
+				errOs := renameOs(oldOsPath, newOsPath)
+				errFake := fs.Rename(oldFakePath, newFakePath)
+				checkSyncError(t, errOs, errFake)
+			},
+			"FS_RenameDir": func(t *rapid.T) {
+				oldOsPath, oldFakePath := getDirPaths()
+				// do not rename over file paths, since directory descriptors differ from ours
+				newOsPath, newFakePath := getDirPaths()
+				errOs := renameOs(oldOsPath, newOsPath)
 				errFake := fs.Rename(oldFakePath, newFakePath)
 				checkSyncError(t, errOs, errFake)
 			},
@@ -400,6 +527,18 @@ func TestFS(t *testing.T) {
 			},
 			"FS_Stat": func(t *rapid.T) {
 				osPath, fakePath := getFilePaths()
+				if rapid.Bool().Draw(t, "odd path") {
+					osPath, fakePath = getOddPaths(dotPaths)
+				}
+				fiOs, errOs := os.Stat(osPath)
+				fiFake, errFake := fs.Stat(fakePath)
+				checkSyncError(t, errOs, errFake)
+				if fiOs != nil {
+					CompareFileInfo(t, fiOs, fiFake)
+				}
+			},
+			"FS_StatDir": func(t *rapid.T) {
+				osPath, fakePath := getDirPaths()
 				fiOs, errOs := os.Stat(osPath)
 				fiFake, errFake := fs.Stat(fakePath)
 				checkSyncError(t, errOs, errFake)
@@ -427,6 +566,59 @@ func TestFS(t *testing.T) {
 				require.NoError(t, err)
 				possibleFilenames = append(possibleFilenames, fpFake.Name())
 			},
+			"FS_Symlink": func(t *rapid.T) {
+				osTarget, fakeTarget := getLinkTarget(possibleFileLinkTargets)
+				p := rapid.SampledFrom(possibleFileLinks).Draw(t, "link path")
+				errOs := os.Symlink(osTarget, filepath.Join(dir, p))
+				errFake := fs.Symlink(fakeTarget, p)
+				checkSyncError(t, errOs, errFake)
+			},
+			"FS_SymlinkDir": func(t *rapid.T) {
+				osTarget, fakeTarget := getLinkTarget(possibleDirLinkTargets)
+				errOs := os.Symlink(osTarget, filepath.Join(dir, "/foo/dlink"))
+				errFake := fs.Symlink(fakeTarget, "/foo/dlink")
+				checkSyncError(t, errOs, errFake)
+			},
+			"FS_Link": func(t *rapid.T) {
+				oldOsPath, oldFakePath := getFilePaths()
+				newOsPath, newFakePath := getFilePaths()
+				errOs := os.Link(oldOsPath, newOsPath)
+				errFake := fs.Link(oldFakePath, newFakePath)
+				checkSyncError(t, errOs, errFake)
+			},
+			"FS_Chtimes": func(t *rapid.T) {
+				osPath, fakePath := getFilePaths()
+				mtime := time.Unix(rapid.Int64Range(0, 1<<32).Draw(t, "mtime"), 0)
+				errOs := os.Chtimes(osPath, time.Time{}, mtime)
+				errFake := fs.Chtimes(fakePath, time.Time{}, mtime)
+				checkSyncError(t, errOs, errFake)
+				if errOs != nil {
+					return
+				}
+				fiOs, errOs := os.Stat(osPath)
+				fiFake, errFake := fs.Stat(fakePath)
+				checkSyncError(t, errOs, errFake)
+				require.Equal(t, fiOs.ModTime(), fiFake.ModTime())
+			},
+			"FS_Readlink": func(t *rapid.T) {
+				osPath, fakePath := getFilePaths()
+				targetOs, errOs := os.Readlink(osPath)
+				targetFake, errFake := fs.Readlink(fakePath)
+				checkSyncError(t, errOs, errFake)
+				if filepath.IsAbs(targetFake) {
+					targetFake = filepath.Join(dir, targetFake)
+				}
+				require.Equal(t, targetOs, targetFake)
+			},
+			"FS_Lstat": func(t *rapid.T) {
+				osPath, fakePath := getFilePaths()
+				fiOs, errOs := os.Lstat(osPath)
+				fiFake, errFake := fs.Lstat(fakePath)
+				checkSyncError(t, errOs, errFake)
+				if fiOs != nil {
+					CompareFileInfo(t, fiOs, fiFake)
+				}
+			},
 			"FS_MkdirTemp": func(t *rapid.T) {
 				osPath, fakePath := getDirPaths()
 				pathOs, errOs := os.MkdirTemp(osPath, "dir*")
@@ -452,8 +644,12 @@ func TestFS(t *testing.T) {
 func CompareFileInfo(t *rapid.T, fiOs os.FileInfo, fiFake os.FileInfo) {
 	require.Equal(t, fiOs.Name(), fiFake.Name())
 	require.Equal(t, fiOs.IsDir(), fiFake.IsDir())
-	require.Equal(t, fiOs.Size(), fiFake.Size())
-	// we do not compare mode, since it depends on parent fs directory, so hard to check in property test
+	require.Equal(t, fiOs.Mode(), fiFake.Mode())
+	if fiOs.Mode().IsRegular() {
+		// link size is target length, and absolute targets differ between os and fake. Directory size is fs specific
+		require.Equal(t, fiOs.Size(), fiFake.Size())
+	}
+	compareSys(t, fiOs, fiFake)
 	// We do not compare time, since it's hard to mock, and not really relevant
 }
 
@@ -464,11 +660,15 @@ func CompareDirEntries(t *rapid.T, diOs []os.DirEntry, diFake []os.DirEntry) {
 	for i := range diOs {
 		require.Equal(t, diOs[i].Name(), diFake[i].Name())
 		require.Equal(t, diOs[i].IsDir(), diFake[i].IsDir())
+		require.Equal(t, diOs[i].Type(), diFake[i].Type())
 		infoOs, errOs := diOs[i].Info()
 		infoFake, errFake := diFake[i].Info()
 		checkSyncError(t, errOs, errFake)
-		if errOs != nil {
-			require.Equal(t, infoOs.Size(), infoFake.Size())
+		if errOs == nil {
+			if infoOs.Mode().IsRegular() {
+				// directory and link sizes are fs specific
+				require.Equal(t, infoOs.Size(), infoFake.Size())
+			}
 			require.Equal(t, infoOs.Mode(), infoFake.Mode())
 		}
 	}
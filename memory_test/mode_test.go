@@ -0,0 +1,149 @@
+package memory
+
+import (
+	iofs "io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMode(t *testing.T) {
+	t.Run("type bits", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/dir", 0755))
+		require.NoError(t, fs.WriteFile("/dir/file", nil, 0644))
+		require.NoError(t, fs.Symlink("file", "/dir/link"))
+
+		fi, err := fs.Stat("/dir")
+		require.NoError(t, err)
+		require.Equal(t, os.ModeDir|0755, fi.Mode())
+		fi, err = fs.Stat("/dir/file")
+		require.NoError(t, err)
+		require.True(t, fi.Mode().IsRegular())
+		fi, err = fs.Lstat("/dir/link")
+		require.NoError(t, err)
+		require.Equal(t, os.ModeSymlink, fi.Mode().Type())
+
+		entries, err := fs.ReadDir("/dir")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		for _, e := range entries {
+			info, err := e.Info()
+			require.NoError(t, err)
+			require.Equal(t, info.Mode().Type(), e.Type())
+			require.Equal(t, iofs.FileInfoToDirEntry(info).Type(), e.Type())
+		}
+	})
+
+	t.Run("chmod keeps special bits", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/dir", 0777))
+		require.NoError(t, fs.Chmod("/dir", os.ModeSticky|0777))
+		fi, err := fs.Stat("/dir")
+		require.NoError(t, err)
+		require.Equal(t, os.ModeDir|os.ModeSticky|0777, fi.Mode())
+
+		require.NoError(t, fs.WriteFile("/file", nil, 0755))
+		require.NoError(t, fs.Chmod("/file", os.ModeSetuid|os.ModeSetgid|os.ModeDir|0755))
+		fi, err = fs.Stat("/file")
+		require.NoError(t, err)
+		require.Equal(t, os.ModeSetuid|os.ModeSetgid|0755, fi.Mode())
+		requireUnixMode(t, fi, syscall.S_IFREG|syscall.S_ISUID|syscall.S_ISGID|0755)
+	})
+
+	t.Run("chown and write drop setuid", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(0, 0))
+		require.NoError(t, fs.WriteFile("/exec", nil, 0755))
+		require.NoError(t, fs.WriteFile("/lock", nil, 0644))
+		require.NoError(t, fs.Mkdir("/dir", 0755))
+		for _, name := range []string{"/exec", "/lock", "/dir"} {
+			fi, err := fs.Stat(name)
+			require.NoError(t, err)
+			require.NoError(t, fs.Chmod(name, os.ModeSetuid|os.ModeSetgid|fi.Mode().Perm()))
+			require.NoError(t, fs.Chown(name, 1000, 100)) // even root drops bits of files
+		}
+		mode := func(name string) os.FileMode {
+			fi, err := fs.Stat(name)
+			require.NoError(t, err)
+			return fi.Mode()
+		}
+		require.Equal(t, os.FileMode(0755), mode("/exec"))
+		require.Equal(t, os.ModeSetgid|0644, mode("/lock")) // setgid without group execute is not about exec
+		require.Equal(t, os.ModeDir|os.ModeSetuid|os.ModeSetgid|0755, mode("/dir"))
+
+		// content change drops bits too, unless done by root
+		require.NoError(t, fs.Chmod("/exec", os.ModeSetuid|os.ModeSetgid|0777))
+		require.NoError(t, fs.WriteFile("/exec", []byte("x"), 0))
+		require.Equal(t, os.ModeSetuid|os.ModeSetgid|0777, mode("/exec"))
+		fs.SetCredentials(1000, 100)
+		fp, err := fs.OpenFile("/exec", os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = fp.Write(nil)
+		require.NoError(t, err)
+		require.Equal(t, os.ModeSetuid|os.ModeSetgid|0777, mode("/exec"))
+		_, err = fp.Write([]byte("x"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0777), mode("/exec"))
+		require.NoError(t, fp.Close())
+
+		require.NoError(t, fs.Chmod("/exec", os.ModeSetuid|0777))
+		require.NoError(t, fs.Truncate("/exec", 1))
+		require.Equal(t, os.FileMode(0777), mode("/exec"))
+	})
+
+	t.Run("special files", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(1000, 100))
+		require.NoError(t, fs.Mknod("/fifo", os.ModeNamedPipe|0644))
+		require.NoError(t, fs.Mknod("/sock", os.ModeSocket|0644))
+		require.True(t, os.IsPermission(fs.Mknod("/dev", os.ModeDevice|0644)))
+		require.Error(t, fs.Mknod("/dir", os.ModeDir|0644))
+
+		fs.SetCredentials(0, 0)
+		require.NoError(t, fs.Mknod("/null", os.ModeDevice|os.ModeCharDevice|0666))
+
+		for name, typ := range map[string]os.FileMode{
+			"/fifo": os.ModeNamedPipe,
+			"/sock": os.ModeSocket,
+			"/null": os.ModeDevice | os.ModeCharDevice,
+		} {
+			fi, err := fs.Stat(name)
+			require.NoError(t, err)
+			require.Equal(t, typ, fi.Mode().Type())
+			require.False(t, fi.Mode().IsRegular())
+			_, err = fs.Open(name)
+			require.ErrorIs(t, err, syscall.ENXIO)
+		}
+	})
+
+	t.Run("umask", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+		require.NoError(t, fs.Mkdir("/dir", os.ModeSticky|0777))
+		require.Equal(t, 0022, fs.Umask(0077))
+		require.NoError(t, fs.MkdirAll("/a/b", 0777))
+		require.NoError(t, fs.Mknod("/fifo", os.ModeNamedPipe|0666))
+		require.NoError(t, fs.Symlink("file", "/link"))
+
+		for name, mode := range map[string]os.FileMode{
+			"/file": 0644,
+			"/dir":  os.ModeDir | os.ModeSticky | 0755,
+			"/a":    os.ModeDir | 0700,
+			"/a/b":  os.ModeDir | 0700,
+			"/fifo": os.ModeNamedPipe | 0600,
+			"/link": os.ModeSymlink | 0777, // symlink permissions are not affected
+		} {
+			fi, err := fs.Lstat(name)
+			require.NoError(t, err)
+			require.Equal(t, mode, fi.Mode(), name)
+		}
+
+		fs = gofs.NewMemoryFs(gofs.WithUmask(0))
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+		fi, err := fs.Stat("/file")
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0666), fi.Mode())
+	})
+}
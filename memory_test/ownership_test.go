@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"os"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnership(t *testing.T) {
+	fs := gofs.NewMemoryFs(gofs.WithCredentials(1000, 100))
+	require.NoError(t, fs.WriteFile("/file", nil, 0666))
+	require.NoError(t, fs.Symlink("file", "/link"))
+
+	fi, err := fs.Stat("/file")
+	require.NoError(t, err)
+	uid, gid := owner(t, fi)
+	require.Equal(t, 1000, uid)
+	require.Equal(t, 100, gid)
+
+	// only root may give file away
+	fs.SetCredentials(0, 0)
+	require.NoError(t, fs.Chown("/link", 2000, -1))
+	fi, err = fs.Stat("/file")
+	require.NoError(t, err)
+	uid, gid = owner(t, fi)
+	require.Equal(t, 2000, uid)
+	require.Equal(t, 100, gid)
+
+	require.NoError(t, fs.Lchown("/link", 3000, 300))
+	fi, err = fs.Lstat("/link")
+	require.NoError(t, err)
+	uid, gid = owner(t, fi)
+	require.Equal(t, 3000, uid)
+	require.Equal(t, 300, gid)
+	fi, err = fs.Stat("/link")
+	require.NoError(t, err)
+	uid, _ = owner(t, fi)
+	require.Equal(t, 2000, uid)
+
+	fp, err := fs.Open("/file")
+	require.NoError(t, err)
+	require.NoError(t, fp.Chown(-1, 500))
+	fi, err = fp.Stat()
+	require.NoError(t, err)
+	_, gid = owner(t, fi)
+	require.Equal(t, 500, gid)
+	require.NoError(t, fp.Close())
+
+	fs.SetCredentials(4000, 400)
+	require.NoError(t, fs.Mkdir("/dir", 0777))
+	fi, err = fs.Stat("/dir")
+	require.NoError(t, err)
+	uid, gid = owner(t, fi)
+	require.Equal(t, 4000, uid)
+	require.Equal(t, 400, gid)
+}
+
+func TestDefaultOwnership(t *testing.T) {
+	// like kernel, new files are owned by effective ids of process
+	fs := gofs.NewMemoryFs()
+	require.NoError(t, fs.WriteFile("/file", nil, 0666))
+	fi, err := fs.Stat("/file")
+	require.NoError(t, err)
+	uid, gid := owner(t, fi)
+	require.Equal(t, os.Geteuid(), uid)
+	require.Equal(t, os.Getegid(), gid)
+}
@@ -0,0 +1,236 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentials(t *testing.T) {
+	const (
+		owner = 1000
+		group = 100
+	)
+
+	canOpen := func(fs *gofs.InMemoryFS, name string, flag int) bool {
+		fp, err := fs.OpenFile(name, flag, 0)
+		if err != nil {
+			require.True(t, os.IsPermission(err))
+			return false
+		}
+		require.NoError(t, fp.Close())
+		return true
+	}
+
+	t.Run("triplet selection", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(0, 0))
+		require.NoError(t, fs.WriteFile("/config", nil, 0640))
+		require.NoError(t, fs.Chown("/config", owner, group))
+
+		fs.SetCredentials(owner, group)
+		require.True(t, canOpen(fs, "/config", os.O_RDWR))
+
+		fs.SetCredentials(2000, group)
+		require.True(t, canOpen(fs, "/config", os.O_RDONLY))
+		require.False(t, canOpen(fs, "/config", os.O_WRONLY))
+
+		fs.SetCredentials(2000, 200)
+		require.False(t, canOpen(fs, "/config", os.O_RDONLY))
+
+		fs.SetCredentials(2000, 200, 300, group)
+		require.True(t, canOpen(fs, "/config", os.O_RDONLY))
+
+		// owner triplet is used even if group or other has more permissions
+		fs.SetCredentials(owner, group)
+		require.NoError(t, fs.Chmod("/config", 0044))
+		require.False(t, canOpen(fs, "/config", os.O_RDONLY))
+		require.Error(t, fs.Truncate("/config", 0))
+	})
+
+	t.Run("root bypass", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(owner, group))
+		require.NoError(t, fs.WriteFile("/secret", nil, 0000))
+		require.False(t, canOpen(fs, "/secret", os.O_RDONLY))
+
+		fs.SetCredentials(0, 0)
+		require.True(t, canOpen(fs, "/secret", os.O_RDWR))
+	})
+
+	t.Run("attribute changes", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(owner, group, 500))
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+
+		require.NoError(t, fs.Chown("/file", -1, 500))
+		require.True(t, os.IsPermission(fs.Chown("/file", -1, 600)))
+		require.True(t, os.IsPermission(fs.Chown("/file", 2000, -1)))
+
+		fs.SetCredentials(2000, group)
+		require.True(t, os.IsPermission(fs.Chmod("/file", 0777)))
+		fp, err := fs.Open("/file")
+		require.NoError(t, err)
+		require.True(t, os.IsPermission(fp.Chmod(0777)))
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("removed working directory", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/dir", 0777))
+		require.NoError(t, fs.Chdir("/dir"))
+		require.NoError(t, fs.Chmod("/dir", 0666))
+		require.NoError(t, fs.Remove("/dir"))
+
+		// search permission is checked before removed directory is noticed
+		_, err := fs.Stat("x")
+		require.True(t, os.IsPermission(err), err)
+	})
+
+	t.Run("remove all reports parent error", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(1000, 100))
+		require.NoError(t, fs.WriteFile("/file", nil, 0222))
+		require.NoError(t, fs.Symlink("file", "/link"))
+
+		// like os.RemoveAll, failed remove is followed by open of parent
+		err := fs.RemoveAll("/link/x")
+		require.True(t, os.IsPermission(err), err)
+		require.NoError(t, fs.Chmod("/file", 0666))
+		err = fs.RemoveAll("/link/x")
+		require.True(t, errors.Is(err, syscall.ENOTDIR), err)
+	})
+}
+
+func TestDirectoryPermissions(t *testing.T) {
+	t.Run("search", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(1000, 100))
+		require.NoError(t, fs.MkdirAll("/dir/sub", 0777))
+		require.NoError(t, fs.WriteFile("/dir/sub/file", []byte("data"), 0666))
+		require.NoError(t, fs.Chmod("/dir", 0666))
+
+		_, err := fs.Stat("/dir/sub/file")
+		require.True(t, os.IsPermission(err))
+		_, err = fs.ReadFile("/dir/sub/file")
+		require.True(t, os.IsPermission(err))
+		require.True(t, os.IsPermission(fs.Chdir("/dir")))
+
+		// names are still readable, but not attributes
+		entries, err := fs.ReadDir("/dir")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "sub", entries[0].Name())
+		_, err = entries[0].Info()
+		require.True(t, os.IsPermission(err))
+
+		fs.SetCredentials(0, 0)
+		_, err = fs.Stat("/dir/sub/file")
+		require.NoError(t, err)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(1000, 100))
+		require.NoError(t, fs.Mkdir("/dir", 0333))
+		require.NoError(t, fs.WriteFile("/dir/file", nil, 0666))
+
+		_, err := fs.ReadDir("/dir")
+		require.True(t, os.IsPermission(err))
+		_, err = fs.Stat("/dir/file")
+		require.NoError(t, err)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(1000, 100))
+		require.NoError(t, fs.MkdirAll("/ro", 0777))
+		require.NoError(t, fs.WriteFile("/ro/file", nil, 0666))
+		require.NoError(t, fs.Mkdir("/rw", 0777))
+		require.NoError(t, fs.Chmod("/ro", 0555))
+
+		_, err := fs.Create("/ro/new")
+		require.True(t, os.IsPermission(err))
+		require.True(t, os.IsPermission(fs.Mkdir("/ro/dir", 0777)))
+		require.True(t, os.IsPermission(fs.Symlink("file", "/ro/link")))
+		require.True(t, os.IsPermission(fs.Link("/ro/file", "/ro/link")))
+		require.True(t, os.IsPermission(fs.Remove("/ro/file")))
+		require.True(t, os.IsPermission(fs.RemoveAll("/ro/file")))
+		require.True(t, os.IsPermission(fs.Rename("/ro/file", "/rw/file")))
+		require.NoError(t, fs.WriteFile("/rw/file", nil, 0666))
+		require.True(t, os.IsPermission(fs.Rename("/rw/file", "/ro/file")))
+
+		// existing file content may still be changed
+		require.NoError(t, fs.WriteFile("/ro/file", []byte("data"), 0666))
+		require.NoError(t, fs.Link("/ro/file", "/rw/link"))
+		require.NoError(t, fs.Remove("/rw/link"))
+	})
+
+	t.Run("without credentials", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/ro/dir", 0777))
+		require.NoError(t, fs.WriteFile("/ro/file", nil, 0666))
+		require.NoError(t, fs.Mkdir("/rw", 0777))
+
+		// both write and search permissions are needed, any triplet may grant each of them
+		for _, mode := range []os.FileMode{0555, 0111, 0666} {
+			require.NoError(t, fs.Chmod("/ro", mode))
+			_, err := fs.Create("/ro/new")
+			require.True(t, os.IsPermission(err), "%o", mode)
+			require.True(t, os.IsPermission(fs.Mkdir("/ro/new", 0777)), "%o", mode)
+			require.True(t, os.IsPermission(fs.Remove("/ro/file")), "%o", mode)
+			require.True(t, os.IsPermission(fs.Rename("/ro/file", "/rw/file")), "%o", mode)
+		}
+
+		require.NoError(t, fs.Chmod("/ro", 0421))
+		require.NoError(t, fs.Rename("/ro/file", "/ro/new"))
+		require.NoError(t, fs.Remove("/ro/new"))
+	})
+}
+
+func TestSpecialDirectoryBits(t *testing.T) {
+	t.Run("sticky", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(0, 0), gofs.WithUmask(0))
+		require.NoError(t, fs.Mkdir("/tmp", os.ModeSticky|0777))
+		fs.SetCredentials(1000, 100)
+		require.NoError(t, fs.WriteFile("/tmp/alice", nil, 0666))
+		require.NoError(t, fs.WriteFile("/tmp/alice.2", nil, 0666))
+
+		fs.SetCredentials(2000, 100)
+		require.NoError(t, fs.WriteFile("/tmp/bob", nil, 0666))
+		require.True(t, os.IsPermission(fs.Remove("/tmp/alice")))
+		require.True(t, os.IsPermission(fs.Rename("/tmp/alice", "/tmp/mine")))
+		require.True(t, os.IsPermission(fs.Rename("/tmp/bob", "/tmp/alice")))
+		// content is still writable, only the name is protected
+		require.NoError(t, fs.WriteFile("/tmp/alice", []byte("data"), 0666))
+
+		fs.SetCredentials(1000, 100)
+		require.NoError(t, fs.Rename("/tmp/alice.2", "/tmp/alice"))
+		require.NoError(t, fs.Remove("/tmp/alice"))
+
+		fs.SetCredentials(0, 0)
+		require.NoError(t, fs.Remove("/tmp/bob"))
+	})
+
+	t.Run("setgid", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithCredentials(0, 0))
+		require.NoError(t, fs.Mkdir("/shared", 0777))
+		require.NoError(t, fs.Chown("/shared", -1, 500))
+		require.NoError(t, fs.Chmod("/shared", os.ModeSetgid|0777))
+
+		fs.SetCredentials(1000, 100)
+		require.NoError(t, fs.WriteFile("/shared/file", nil, 0666))
+		require.NoError(t, fs.MkdirAll("/shared/a/b", 0777))
+		require.NoError(t, fs.Mkdir("/private", 0777))
+
+		for _, name := range []string{"/shared/file", "/shared/a", "/shared/a/b"} {
+			fi, err := fs.Stat(name)
+			require.NoError(t, err)
+			_, gid := owner(t, fi)
+			require.Equal(t, 500, gid, name)
+			require.Equal(t, fi.IsDir(), fi.Mode()&os.ModeSetgid != 0, name)
+		}
+		fi, err := fs.Stat("/private")
+		require.NoError(t, err)
+		_, gid := owner(t, fi)
+		require.Equal(t, 100, gid)
+		require.Zero(t, fi.Mode()&os.ModeSetgid)
+	})
+}
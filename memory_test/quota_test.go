@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func requireUsage(t *testing.T, fs *gofs.InMemoryFS, dir string, bytes, inodes int64) {
+	t.Helper()
+	q, err := fs.Quota(dir)
+	require.NoError(t, err)
+	require.Equal(t, bytes, q.UsedBytes, "used bytes of %s", dir)
+	require.Equal(t, inodes, q.UsedInodes, "used inodes of %s", dir)
+}
+
+func TestQuota(t *testing.T) {
+	t.Run("bytes", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/tenant", 0777))
+		require.NoError(t, fs.SetQuota("/tenant", 10, 0))
+
+		fp, err := fs.Create("/tenant/data")
+		require.NoError(t, err)
+		n, err := fp.Write(make([]byte, 12))
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+		require.Equal(t, 10, n)
+		require.True(t, errors.Is(fp.Truncate(11), syscall.EDQUOT))
+		require.NoError(t, fs.WriteFile("/outside", make([]byte, 100), 0666))
+		requireUsage(t, fs, "/tenant", 10, 1)
+
+		// removed file is charged until closed
+		require.NoError(t, fs.Remove("/tenant/data"))
+		requireUsage(t, fs, "/tenant", 10, 1)
+		require.NoError(t, fp.Close())
+		requireUsage(t, fs, "/tenant", 0, 0)
+
+		// error tells which limit is hit first
+		fs.SetCapacity(120, 0)
+		err = fs.WriteFile("/tenant/data", make([]byte, 15), 0666)
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+		fs.SetCapacity(103, 0)
+		err = fs.WriteFile("/tenant/data", make([]byte, 8), 0666)
+		require.True(t, errors.Is(err, syscall.ENOSPC), "%v", err)
+	})
+
+	t.Run("inodes", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/tenant/dir", 0777))
+		require.NoError(t, fs.SetQuota("/tenant", 0, 2))
+
+		require.NoError(t, fs.Symlink("dir", "/tenant/link"))
+		err := fs.WriteFile("/tenant/dir/file", nil, 0666)
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+		err = fs.Mkdir("/tenant/dir2", 0777)
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+		require.NoError(t, fs.Mkdir("/dir2", 0777))
+		requireUsage(t, fs, "/tenant", 0, 2)
+
+		require.NoError(t, fs.Remove("/tenant/link"))
+		require.NoError(t, fs.WriteFile("/tenant/dir/file", nil, 0666))
+	})
+
+	t.Run("existing content", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/tenant/dir", 0777))
+		require.NoError(t, fs.WriteFile("/tenant/dir/a", make([]byte, 5), 0666))
+		require.NoError(t, fs.Link("/tenant/dir/a", "/tenant/b"))
+		require.NoError(t, fs.SetQuota("/tenant", 4, 0))
+		requireUsage(t, fs, "/tenant", 5, 2)
+
+		err := fs.WriteFile("/tenant/c", []byte("x"), 0666)
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+
+		// raising limit keeps usage
+		require.NoError(t, fs.SetQuota("/tenant", 10, 0))
+		require.NoError(t, fs.WriteFile("/tenant/c", []byte("x"), 0666))
+		requireUsage(t, fs, "/tenant", 6, 3)
+
+		_, err = fs.Quota("/tenant/dir")
+		require.True(t, errors.Is(err, syscall.ESRCH), "%v", err)
+		err = fs.SetQuota("/tenant/c", 1, 1)
+		require.True(t, errors.Is(err, syscall.ENOTDIR), "%v", err)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/tenant", 0777))
+		require.NoError(t, fs.SetQuota("/tenant", 10, 0))
+		require.NoError(t, fs.MkdirAll("/src/sub", 0777))
+		require.NoError(t, fs.WriteFile("/src/sub/a", make([]byte, 4), 0666))
+		require.NoError(t, fs.WriteFile("/src/b", make([]byte, 3), 0666))
+		require.NoError(t, fs.WriteFile("/big", make([]byte, 11), 0666))
+
+		// subtree is charged on the way in...
+		require.NoError(t, fs.Rename("/src", "/tenant/src"))
+		requireUsage(t, fs, "/tenant", 7, 4)
+		err := fs.Rename("/big", "/tenant/big")
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+		_, err = fs.Stat("/big")
+		require.NoError(t, err)
+
+		// ...and within quota nothing changes
+		require.NoError(t, fs.Rename("/tenant/src/sub", "/tenant/sub"))
+		requireUsage(t, fs, "/tenant", 7, 4)
+
+		// ...and freed on the way out
+		require.NoError(t, fs.Rename("/tenant/sub", "/sub"))
+		requireUsage(t, fs, "/tenant", 3, 2)
+		require.NoError(t, fs.WriteFile("/tenant/src/b", make([]byte, 10), 0666))
+
+		// files moved out are not charged anymore
+		require.NoError(t, fs.WriteFile("/sub/a", make([]byte, 100), 0666))
+		requireUsage(t, fs, "/tenant", 10, 2)
+
+		// quota root moves with its quota
+		require.NoError(t, fs.Mkdir("/home", 0777))
+		require.NoError(t, fs.Rename("/tenant", "/home/tenant"))
+		requireUsage(t, fs, "/home/tenant", 10, 2)
+		err = fs.WriteFile("/home/tenant/src/c", []byte("x"), 0666)
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/outer/inner", 0777))
+		require.NoError(t, fs.SetQuota("/outer/inner", 0, 0))
+		require.NoError(t, fs.WriteFile("/outer/inner/a", make([]byte, 6), 0666))
+		require.NoError(t, fs.SetQuota("/outer", 10, 0))
+		requireUsage(t, fs, "/outer", 6, 2)
+		requireUsage(t, fs, "/outer/inner", 6, 1)
+
+		err := fs.WriteFile("/outer/inner/b", make([]byte, 5), 0666)
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+		require.NoError(t, fs.Remove("/outer/inner/b"))
+
+		require.NoError(t, fs.Rename("/outer/inner/a", "/outer/a"))
+		requireUsage(t, fs, "/outer", 6, 2)
+		requireUsage(t, fs, "/outer/inner", 0, 0)
+
+		require.NoError(t, fs.Rename("/outer/inner", "/inner"))
+		requireUsage(t, fs, "/outer", 6, 1)
+		require.NoError(t, fs.WriteFile("/inner/b", make([]byte, 5), 0666))
+		err = fs.Rename("/inner", "/outer/inner")
+		require.True(t, errors.Is(err, syscall.EDQUOT), "%v", err)
+	})
+
+	t.Run("link across quota", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/tenant", 0777))
+		require.NoError(t, fs.SetQuota("/tenant", 0, 0))
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+		err := fs.Link("/file", "/tenant/file")
+		require.True(t, errors.Is(err, syscall.EXDEV), "%v", err)
+		_, err = fs.Stat("/tenant/file")
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("rename of linked file across quota", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/q", 0777))
+		require.NoError(t, fs.SetQuota("/q", 10, 0))
+		require.NoError(t, fs.WriteFile("/a", make([]byte, 5), 0666))
+		require.NoError(t, fs.Link("/a", "/b"))
+		err := fs.Rename("/b", "/q/b")
+		require.True(t, errors.Is(err, syscall.EXDEV), "%v", err)
+		require.NoError(t, fs.Mkdir("/dir", 0777))
+		require.NoError(t, fs.Rename("/b", "/dir/b"))
+		err = fs.Rename("/dir", "/q/dir")
+		require.True(t, errors.Is(err, syscall.EXDEV), "%v", err)
+
+		// data written through other link is not limited by quota
+		require.NoError(t, fs.WriteFile("/a", make([]byte, 20), 0666))
+		requireUsage(t, fs, "/q", 0, 0)
+
+		// once all links are moved together, rename is fine
+		require.NoError(t, fs.Rename("/a", "/dir/a"))
+		require.NoError(t, fs.SetQuota("/q", 0, 0))
+		require.NoError(t, fs.Rename("/dir", "/q/dir"))
+		requireUsage(t, fs, "/q", 20, 2)
+		require.NoError(t, fs.RemoveAll("/q/dir"))
+		requireUsage(t, fs, "/q", 0, 0)
+	})
+}
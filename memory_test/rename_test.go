@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRename(t *testing.T) {
+	t.Run("directory subtree", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/a/sub", 0777))
+		require.NoError(t, fs.WriteFile("/a/sub/file", []byte("data"), 0666))
+		require.NoError(t, fs.Mkdir("/dst", 0777))
+
+		require.NoError(t, fs.Rename("/a", "/dst/b"))
+		data, err := fs.ReadFile("/dst/b/sub/file")
+		require.NoError(t, err)
+		require.Equal(t, "data", string(data))
+		_, err = fs.Stat("/a/sub/file")
+		require.True(t, os.IsNotExist(err))
+
+		// ".." follows the directory to its new parent
+		require.NoError(t, fs.Chdir("/dst/b/sub"))
+		_, err = fs.Stat("../../b")
+		require.NoError(t, err)
+
+		fi, err := fs.Stat("/dst")
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), nlink(t, fi))
+		fi, err = fs.Stat("/")
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), nlink(t, fi))
+	})
+
+	t.Run("over empty directory", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/a/x", 0777))
+		require.NoError(t, fs.Mkdir("/b", 0777))
+
+		require.NoError(t, fs.Rename("/a", "/b"))
+		_, err := fs.Stat("/b/x")
+		require.NoError(t, err)
+		_, err = fs.Stat("/a")
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/a/b/c", 0777))
+		require.NoError(t, fs.MkdirAll("/full/x", 0777))
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+
+		requireErrno := func(want syscall.Errno, oldpath, newpath string) {
+			t.Helper()
+			err := fs.Rename(oldpath, newpath)
+			require.True(t, errors.Is(err, want), "%s -> %s: %v", oldpath, newpath, err)
+		}
+		requireErrno(syscall.EINVAL, "/a", "/a/b/c/d")
+		requireErrno(syscall.EINVAL, "/a", "/a/b")
+		requireErrno(syscall.ENOTEMPTY, "/a", "/full")
+		requireErrno(syscall.ENOTEMPTY, "/a/b/c", "/a")
+		requireErrno(syscall.ENOTDIR, "/a", "/file")
+		requireErrno(syscall.EISDIR, "/file", "/a")
+		requireErrno(syscall.ENOTDIR, "/file", "/new/")
+
+		// nothing has moved
+		_, err := fs.Stat("/a/b/c")
+		require.NoError(t, err)
+		_, err = fs.Stat("/full/x")
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortIO(t *testing.T) {
+	t.Run("scripted", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithShortIO(gofs.ScriptedShortIO(2, 0, 3), gofs.ScriptedShortIO(4)))
+		fp, err := fs.Create("/file")
+		require.NoError(t, err)
+
+		n, err := fp.Write([]byte("0123456789"))
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+		n, err = fp.Write([]byte("456789"))
+		require.NoError(t, err)
+		require.Equal(t, 6, n)
+
+		buf := make([]byte, 10)
+		_, err = fp.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		n, err = fp.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "01", string(buf[:n]))
+		n, err = fp.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "23456789", string(buf[:n]))
+
+		// ReadAt keeps reading until buffer is full
+		n, err = fp.ReadAt(buf[:5], 0)
+		require.NoError(t, err)
+		require.Equal(t, "01234", string(buf[:n]))
+		require.NoError(t, fp.Close())
+	})
+
+	t.Run("random", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		data := make([]byte, 10000)
+		rand.New(rand.NewSource(1)).Read(data)
+		fs.SetShortIO(
+			gofs.RandomShortIO(rand.New(rand.NewSource(2)), 0.5),
+			gofs.RandomShortIO(rand.New(rand.NewSource(3)), 0.5),
+		)
+
+		fp, err := fs.Create("/file")
+		require.NoError(t, err)
+		sawShort := false
+		for i := 0; i < 100; i++ {
+			n, err := fp.Write(data)
+			require.NoError(t, err)
+			require.LessOrEqual(t, n, len(data))
+			sawShort = sawShort || n < len(data)
+			require.NoError(t, fp.Truncate(0))
+			_, err = fp.Seek(0, io.SeekStart)
+			require.NoError(t, err)
+		}
+		require.True(t, sawShort)
+
+		// helpers retry like stdlib does
+		n, err := fp.WriteAt(data, 0)
+		require.NoError(t, err)
+		require.Equal(t, len(data), n)
+		require.NoError(t, fp.Truncate(0))
+		written, err := fp.ReadFrom(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), written)
+		require.NoError(t, fp.Close())
+
+		require.NoError(t, fs.WriteFile("/copy", data, 0666))
+		read, err := fs.ReadFile("/copy")
+		require.NoError(t, err)
+		require.Equal(t, data, read)
+
+		fs.SetShortIO(nil, nil)
+		fp, err = fs.Open("/copy")
+		require.NoError(t, err)
+		n, err = fp.Read(make([]byte, len(data)))
+		require.NoError(t, err)
+		require.Equal(t, len(data), n)
+		require.NoError(t, fp.Close())
+	})
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowFS(t *testing.T) {
+	start := time.Unix(0, 0)
+	newFs := func(model gofs.PerfModel) (*gofs.SlowFS, *gofs.FakeClock) {
+		clock := gofs.NewFakeClock(start)
+		return gofs.NewSlowFS(gofs.NewThreadSafeMemoryFs(gofs.WithClock(clock)), model, nil, clock), clock
+	}
+	elapsed := func(clock *gofs.FakeClock) time.Duration {
+		return clock.Now().Sub(start)
+	}
+
+	t.Run("latency", func(t *testing.T) {
+		fs, clock := newFs(gofs.PerfModel{Latency: map[string]gofs.Delay{
+			"OpenFile": gofs.ConstantDelay(10 * time.Millisecond),
+			"":         gofs.ConstantDelay(time.Millisecond),
+		}})
+		fp, err := fs.OpenFile("/file", os.O_CREATE|os.O_RDWR, 0666)
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Millisecond, elapsed(clock))
+
+		_, err = fp.Write([]byte("data"))
+		require.NoError(t, err)
+		require.NoError(t, fp.Close())
+		require.Equal(t, 12*time.Millisecond, elapsed(clock))
+
+		// timestamps of wrapped fs agree with delays
+		info, err := fs.Stat("/file")
+		require.NoError(t, err)
+		require.Equal(t, start.Add(11*time.Millisecond), info.ModTime())
+
+		fs.SetModel(gofs.PerfModel{})
+		_, err = fs.Stat("/file")
+		require.NoError(t, err)
+		require.Equal(t, 13*time.Millisecond, elapsed(clock))
+	})
+
+	t.Run("bandwidth", func(t *testing.T) {
+		fs, clock := newFs(gofs.PerfModel{ReadBandwidth: 2 << 20, WriteBandwidth: 1 << 20, SyncBandwidth: 4 << 20})
+		fp, err := fs.Create("/file")
+		require.NoError(t, err)
+		_, err = fp.Write(make([]byte, 1<<20))
+		require.NoError(t, err)
+		require.Equal(t, time.Second, elapsed(clock))
+
+		require.NoError(t, fp.Sync())
+		require.Equal(t, 1250*time.Millisecond, elapsed(clock))
+		// nothing to flush
+		require.NoError(t, fp.Sync())
+		require.Equal(t, 1250*time.Millisecond, elapsed(clock))
+
+		n, err := fp.ReadAt(make([]byte, 2<<20), 0)
+		require.Error(t, err)
+		require.Equal(t, 1<<20, n)
+		require.Equal(t, 1750*time.Millisecond, elapsed(clock))
+		require.NoError(t, fp.Close())
+
+		_, err = fs.ReadFile("/file")
+		require.NoError(t, err)
+		require.Equal(t, 2250*time.Millisecond, elapsed(clock))
+	})
+
+	t.Run("shared bandwidth", func(t *testing.T) {
+		fs, clock := newFs(gofs.PerfModel{WriteBandwidth: 1 << 20})
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				fp, err := fs.Create(filepath.Join("/", string(rune('a'+i))))
+				require.NoError(t, err)
+				_, err = fp.Write(make([]byte, 256<<10))
+				require.NoError(t, err)
+				require.NoError(t, fp.Close())
+			}(i)
+		}
+		wg.Wait()
+		require.Equal(t, time.Second, elapsed(clock))
+	})
+
+	t.Run("distributions", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		uniform := gofs.UniformDelay(time.Millisecond, 2*time.Millisecond)
+		longTail := gofs.LongTailDelay(time.Millisecond, time.Second, 1.5)
+		var tail int
+		for i := 0; i < 1000; i++ {
+			d := uniform(r)
+			require.True(t, d >= time.Millisecond && d < 2*time.Millisecond, d)
+			d = longTail(r)
+			require.True(t, d >= time.Millisecond && d <= time.Second, d)
+			if d > 10*time.Millisecond {
+				tail++
+			}
+		}
+		// P(d > 10*lo) = 10^-1.5
+		require.InDelta(t, 32, tail, 20)
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		run := func() time.Duration {
+			clock := gofs.NewFakeClock(start)
+			model := gofs.PerfModel{Latency: map[string]gofs.Delay{"": gofs.UniformDelay(0, time.Second)}}
+			fs := gofs.NewSlowFS(gofs.NewMemoryFs(), model, rand.New(rand.NewSource(7)), clock)
+			for i := 0; i < 10; i++ {
+				require.NoError(t, fs.WriteFile("/file", []byte("data"), 0666))
+			}
+			return elapsed(clock)
+		}
+		require.Equal(t, run(), run())
+	})
+
+	t.Run("os sleeps", func(t *testing.T) {
+		model := gofs.PerfModel{Latency: map[string]gofs.Delay{"Stat": gofs.ConstantDelay(20 * time.Millisecond)}}
+		fs := gofs.NewSlowFS(gofs.OsFs(), model, nil, nil)
+		before := time.Now()
+		_, err := fs.Stat(t.TempDir())
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(before), 20*time.Millisecond)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/myxo/gofs"
 )
@@ -182,6 +183,11 @@ func (s *statFs) Chown(name string, uid, gid int) error {
 	return s.fs.Chown(name, uid, gid)
 }
 
+func (s *statFs) Lchown(name string, uid, gid int) error {
+	addStat("fs_Lchown")
+	return s.fs.Lchown(name, uid, gid)
+}
+
 func (s *statFs) Mkdir(name string, perm os.FileMode) error {
 	addStat("fs_Mkdir")
 	return s.fs.Mkdir(name, perm)
@@ -245,3 +251,28 @@ func (s *statFs) Stat(name string) (os.FileInfo, error) {
 	addStat("fs_Stat")
 	return s.fs.Stat(name)
 }
+
+func (s *statFs) Lstat(name string) (os.FileInfo, error) {
+	addStat("fs_Lstat")
+	return s.fs.Lstat(name)
+}
+
+func (s *statFs) Symlink(oldname, newname string) error {
+	addStat("fs_Symlink")
+	return s.fs.Symlink(oldname, newname)
+}
+
+func (s *statFs) Link(oldname, newname string) error {
+	addStat("fs_Link")
+	return s.fs.Link(oldname, newname)
+}
+
+func (s *statFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	addStat("fs_Chtimes")
+	return s.fs.Chtimes(name, atime, mtime)
+}
+
+func (s *statFs) Statfs(path string) (gofs.FsStat, error) {
+	addStat("fs_Statfs")
+	return s.fs.Statfs(path)
+}
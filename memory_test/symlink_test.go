@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlink(t *testing.T) {
+	t.Run("intermediate and relative links", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.MkdirAll("/a/b", 0777))
+		require.NoError(t, fs.WriteFile("/a/b/file", []byte("hello"), 0666))
+		require.NoError(t, fs.Symlink("a/b", "/link"))
+		require.NoError(t, fs.Symlink("../b/file", "/a/b/rel"))
+
+		data, err := fs.ReadFile("/link/rel")
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), data)
+
+		fi, err := fs.Lstat("/link/rel")
+		require.NoError(t, err)
+		require.Equal(t, os.ModeSymlink, fi.Mode()&os.ModeSymlink)
+		fi, err = fs.Stat("/link/rel")
+		require.NoError(t, err)
+		require.Equal(t, "rel", fi.Name())
+		require.Equal(t, int64(5), fi.Size())
+
+		target, err := fs.Readlink("/link/rel")
+		require.NoError(t, err)
+		require.Equal(t, "../b/file", target)
+		_, err = fs.Readlink("/a/b/file")
+		require.True(t, errors.Is(err, syscall.EINVAL))
+	})
+
+	t.Run("dangling link", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Symlink("/target", "/link"))
+		_, err := fs.Stat("/link")
+		require.True(t, os.IsNotExist(err))
+		_, err = fs.OpenFile("/link", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		require.True(t, os.IsExist(err))
+
+		require.NoError(t, fs.WriteFile("/link", []byte("data"), 0666))
+		data, err := fs.ReadFile("/target")
+		require.NoError(t, err)
+		require.Equal(t, []byte("data"), data)
+
+		require.NoError(t, fs.Remove("/link"))
+		_, err = fs.Stat("/target")
+		require.NoError(t, err)
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Symlink("b", "/a"))
+		require.NoError(t, fs.Symlink("a", "/b"))
+		_, err := fs.Stat("/a")
+		require.True(t, errors.Is(err, syscall.ELOOP))
+		_, err = fs.Open("/a/file")
+		require.True(t, errors.Is(err, syscall.ELOOP))
+		_, err = fs.Lstat("/a")
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		err := fs.Symlink("", "/link")
+		require.True(t, os.IsNotExist(err), err)
+		_, err = fs.Lstat("/link")
+		require.True(t, os.IsNotExist(err))
+
+		_, err = fs.OpenFile("/new/", os.O_CREATE|os.O_WRONLY, 0666)
+		require.True(t, errors.Is(err, syscall.EISDIR), err)
+		require.NoError(t, fs.Symlink("/target", "/dangling"))
+		_, err = fs.OpenFile("/dangling/", os.O_CREATE|os.O_WRONLY, 0666)
+		require.True(t, errors.Is(err, syscall.EISDIR), err)
+		_, err = fs.Stat("/target")
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+		require.NoError(t, fs.Symlink("file", "/link"))
+		_, err := fs.Stat("/link/x")
+		require.True(t, errors.Is(err, syscall.ENOTDIR))
+		require.True(t, errors.Is(fs.Chdir("/link"), syscall.ENOTDIR))
+	})
+
+	t.Run("trailing slash", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/f", nil, 0666))
+		require.NoError(t, fs.Mkdir("/d", 0777))
+		require.NoError(t, fs.Symlink("f", "/lf"))
+		require.NoError(t, fs.Symlink("d", "/ld"))
+
+		// entry itself is created, removed or renamed, so the last link is not followed
+		for name, c := range map[string]struct {
+			err, want error
+		}{
+			"Remove /lf/":        {fs.Remove("/lf/"), syscall.ENOTDIR},
+			"Remove /ld/":        {fs.Remove("/ld/"), syscall.ENOTDIR},
+			"Remove /f/":         {fs.Remove("/f/"), syscall.ENOTDIR},
+			"Rename /lf/ /x":     {fs.Rename("/lf/", "/x"), syscall.ENOTDIR},
+			"Rename /ld/ /x":     {fs.Rename("/ld/", "/x"), syscall.ENOTDIR},
+			"Rename /f /x/":      {fs.Rename("/f", "/x/"), syscall.ENOTDIR},
+			"Rename /d /lf/":     {fs.Rename("/d", "/lf/"), syscall.ENOTDIR},
+			"Rename /d /ld/":     {fs.Rename("/d", "/ld/"), syscall.ENOTDIR},
+			"Mkdir /ld/":         {fs.Mkdir("/ld/", 0777), os.ErrExist},
+			"Symlink f /ld/":     {fs.Symlink("f", "/ld/"), os.ErrExist},
+			"Symlink f /s/":      {fs.Symlink("f", "/s/"), os.ErrNotExist},
+			"Link /f /h/":        {fs.Link("/f", "/h/"), os.ErrNotExist},
+			"Link /lf/ /h":       {fs.Link("/lf/", "/h"), syscall.ENOTDIR},
+			"Mknod /p/":          {fs.Mknod("/p/", os.ModeNamedPipe|0666), os.ErrNotExist},
+			"OpenFile /f/ creat": {openErr(fs, "/f/", os.O_CREATE|os.O_RDONLY), syscall.EISDIR},
+		} {
+			require.True(t, errors.Is(c.err, c.want), "%s: %v", name, c.err)
+		}
+		for _, name := range []string{"/f", "/d", "/lf", "/ld"} {
+			_, err := fs.Lstat(name)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, fs.RemoveAll("/lf/")) // like os.RemoveAll, which strips trailing slash
+		_, err := fs.Lstat("/lf")
+		require.True(t, os.IsNotExist(err))
+		require.NoError(t, fs.Mkdir("/new/", 0777))
+		require.NoError(t, fs.Rename("/new", "/d2/"))
+	})
+
+	t.Run("dot as last component", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/f", nil, 0666))
+		require.NoError(t, fs.Mkdir("/d", 0777))
+		require.NoError(t, fs.Mkdir("/e", 0777))
+
+		_, statErr := fs.Stat("/f/.")
+		for name, c := range map[string]struct {
+			err, want error
+		}{
+			"Stat /f/.":          {statErr, syscall.ENOTDIR},
+			"Mkdir /nd/.":        {fs.Mkdir("/nd/.", 0777), os.ErrNotExist},
+			"Mkdir /d/.":         {fs.Mkdir("/d/.", 0777), os.ErrExist},
+			"OpenFile /nf/.":     {openErr(fs, "/nf/.", os.O_CREATE|os.O_RDONLY), os.ErrNotExist},
+			"OpenFile /d/.":      {openErr(fs, "/d/.", os.O_CREATE|os.O_RDONLY), syscall.EISDIR},
+			"Remove /f/.":        {fs.Remove("/f/."), syscall.ENOTDIR},
+			"Remove /d/.":        {fs.Remove("/d/."), syscall.EINVAL},
+			"Remove /d/..":       {fs.Remove("/d/.."), syscall.ENOTEMPTY},
+			"RemoveAll /e/.":     {fs.RemoveAll("/e/."), syscall.EINVAL},
+			"Rename /d/. /x":     {fs.Rename("/d/.", "/x"), syscall.EBUSY},
+			"Rename /f /d/..":    {fs.Rename("/f", "/d/.."), syscall.EBUSY},
+			"Symlink f /d/.":     {fs.Symlink("f", "/d/."), os.ErrExist},
+			"Link /f /d/.":       {fs.Link("/f", "/d/."), os.ErrExist},
+			"Link /d/. /h":       {fs.Link("/d/.", "/h"), syscall.EPERM},
+			"Mknod /f/.":         {fs.Mknod("/f/.", os.ModeNamedPipe|0666), syscall.ENOTDIR},
+			"OpenFile /d/. excl": {openErr(fs, "/d/.", os.O_CREATE|os.O_EXCL|os.O_RDONLY), os.ErrExist},
+		} {
+			require.True(t, errors.Is(c.err, c.want), "%s: %v", name, c.err)
+		}
+		for _, name := range []string{"/f", "/d", "/e"} {
+			_, err := fs.Lstat(name)
+			require.NoError(t, err)
+		}
+	})
+}
+
+func openErr(fs *gofs.InMemoryFS, name string, flag int) error {
+	fp, err := fs.OpenFile(name, flag, 0666)
+	if err == nil {
+		_ = fp.Close()
+	}
+	return err
+}
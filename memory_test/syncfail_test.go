@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"math/rand"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncFailure(t *testing.T) {
+	// prepare returns file with durable "old" content overwritten with not synced "new"
+	prepare := func(t *testing.T) (*gofs.InMemoryFS, *gofs.File) {
+		fs := gofs.NewMemoryFs()
+		fs.TrackDirtyPages()
+		writeSynced(t, fs, "/file", "old")
+		syncDir(t, fs, "/")
+		fp, err := fs.OpenFile("/file", os.O_RDWR, 0)
+		require.NoError(t, err)
+		_, err = fp.WriteAt([]byte("new"), 0)
+		require.NoError(t, err)
+		return fs, fp
+	}
+
+	t.Run("drop dirty", func(t *testing.T) {
+		for seed := int64(0); seed < 10; seed++ {
+			fs, fp := prepare(t)
+			fs.SetSyncFailure("/file", 1, gofs.DropDirtyOnSyncFailure)
+			err := fp.Sync()
+			require.ErrorIs(t, err, syscall.EIO)
+			var pathErr *os.PathError
+			require.ErrorAs(t, err, &pathErr)
+			require.Equal(t, "/file", pathErr.Path)
+			// retry reports success, and page cache still has new data
+			require.NoError(t, fp.Sync())
+			data, err := fs.ReadFile("/file")
+			require.NoError(t, err)
+			require.Equal(t, "new", string(data))
+
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			data, err = fs.ReadFile("/file")
+			require.NoError(t, err)
+			require.Equal(t, "old", string(data))
+		}
+	})
+
+	t.Run("keep dirty", func(t *testing.T) {
+		for seed := int64(0); seed < 10; seed++ {
+			fs, fp := prepare(t)
+			fs.SetSyncFailure("", 1, gofs.KeepDirtyOnSyncFailure)
+			require.ErrorIs(t, fp.Sync(), syscall.EIO)
+			require.NoError(t, fp.Sync())
+
+			fs.Crash(rand.New(rand.NewSource(seed)))
+			data, err := fs.ReadFile("/file")
+			require.NoError(t, err)
+			require.Equal(t, "new", string(data))
+		}
+	})
+
+	t.Run("pattern and count", func(t *testing.T) {
+		fs, fp := prepare(t)
+		other, err := fs.Create("/other")
+		require.NoError(t, err)
+		fs.SetSyncFailure("/f*", 2, gofs.KeepDirtyOnSyncFailure)
+		require.NoError(t, other.Sync())
+		require.Error(t, fp.Sync())
+		require.Error(t, fp.Sync())
+		require.NoError(t, fp.Sync())
+
+		fs.SetSyncFailure("", 1, gofs.KeepDirtyOnSyncFailure)
+		fs.SetSyncFailure("", 0, gofs.KeepDirtyOnSyncFailure)
+		require.NoError(t, fp.Sync())
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		fs := gofs.NewThreadSafeMemoryFs()
+		fs.TrackDirtyPages()
+		writeSynced(t, fs, "/file", "data")
+		dir, err := fs.Open("/")
+		require.NoError(t, err)
+		fs.SetSyncFailure("/", 1, gofs.DropDirtyOnSyncFailure)
+		require.ErrorIs(t, dir.Sync(), syscall.EIO)
+		require.NoError(t, dir.Close())
+
+		// create is still not durable
+		fs.CrashWith(func(n int) int { return 0 })
+		_, err = fs.Stat("/file")
+		require.True(t, os.IsNotExist(err))
+	})
+}
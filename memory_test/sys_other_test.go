@@ -0,0 +1,30 @@
+//go:build !linux && !darwin
+
+package memory
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func nlink(t *testing.T, fi os.FileInfo) uint64 {
+	t.Skip("link count is not available on this platform")
+	return 0
+}
+
+func requireUnixMode(t *testing.T, fi os.FileInfo, mode uint32) {
+	t.Skip("unix mode is not available on this platform")
+}
+
+func owner(t *testing.T, fi os.FileInfo) (int, int) {
+	t.Skip("file owner is not available on this platform")
+	return 0, 0
+}
+
+func processUmask() int {
+	return 0o022
+}
+
+func compareSys(t require.TestingT, fiOs os.FileInfo, fiFake os.FileInfo) {}
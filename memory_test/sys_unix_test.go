@@ -0,0 +1,50 @@
+//go:build linux || darwin
+
+package memory
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Helpers below read *syscall.Stat_t, which InMemoryFS provides only on linux and darwin
+
+func nlink(t *testing.T, fi os.FileInfo) uint64 {
+	t.Helper()
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	return uint64(st.Nlink)
+}
+
+// requireUnixMode checks raw mode, including file type and special bits
+func requireUnixMode(t *testing.T, fi os.FileInfo, mode uint32) {
+	t.Helper()
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	require.Equal(t, mode, uint32(st.Mode))
+}
+
+func owner(t *testing.T, fi os.FileInfo) (int, int) {
+	t.Helper()
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	return int(st.Uid), int(st.Gid)
+}
+
+// processUmask returns file mode creation mask of test process
+func processUmask() int {
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	return umask
+}
+
+// compareSys checks that link count and owner agree between os and fake
+func compareSys(t require.TestingT, fiOs os.FileInfo, fiFake os.FileInfo) {
+	statOs, statFake := fiOs.Sys().(*syscall.Stat_t), fiFake.Sys().(*syscall.Stat_t)
+	require.Equal(t, uint64(statOs.Nlink), uint64(statFake.Nlink))
+	require.Equal(t, statOs.Uid, statFake.Uid)
+	require.Equal(t, statOs.Gid, statFake.Gid)
+}
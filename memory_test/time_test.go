@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func mtime(t *testing.T, fs *gofs.InMemoryFS, name string) time.Time {
+	t.Helper()
+	fi, err := fs.Stat(name)
+	require.NoError(t, err)
+	return fi.ModTime()
+}
+
+func TestTimestamps(t *testing.T) {
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("write and truncate update mtime", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		fp, err := fs.Create("/file")
+		require.NoError(t, err)
+		require.NoError(t, fs.Chtimes("/file", past, past))
+		require.Equal(t, past, mtime(t, fs, "/file"))
+
+		_, err = fp.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.True(t, mtime(t, fs, "/file").After(past))
+
+		require.NoError(t, fs.Chtimes("/file", time.Time{}, past))
+		require.NoError(t, fs.Truncate("/file", 1))
+		require.True(t, mtime(t, fs, "/file").After(past))
+	})
+
+	t.Run("chmod does not update mtime", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.WriteFile("/file", nil, 0666))
+		require.NoError(t, fs.Chtimes("/file", past, past))
+		require.NoError(t, fs.Chmod("/file", 0600))
+		require.Equal(t, past, mtime(t, fs, "/file"))
+	})
+
+	t.Run("parent directory mtime", func(t *testing.T) {
+		fs := gofs.NewMemoryFs()
+		require.NoError(t, fs.Mkdir("/dir", 0777))
+
+		for _, op := range []func() error{
+			func() error { return fs.WriteFile("/dir/file", nil, 0666) },
+			func() error { return fs.Mkdir("/dir/sub", 0777) },
+			func() error { return fs.Symlink("file", "/dir/link") },
+			func() error { return fs.Link("/dir/file", "/dir/hard") },
+			func() error { return fs.Rename("/dir/hard", "/dir/hard2") },
+			func() error { return fs.Remove("/dir/hard2") },
+		} {
+			require.NoError(t, fs.Chtimes("/dir", past, past))
+			require.NoError(t, op())
+			require.True(t, mtime(t, fs, "/dir").After(past))
+		}
+
+		// open of existing file does not change directory
+		require.NoError(t, fs.Chtimes("/dir", past, past))
+		fp, err := fs.OpenFile("/dir/file", os.O_RDWR, 0)
+		require.NoError(t, err)
+		require.NoError(t, fp.Close())
+		require.Equal(t, past, mtime(t, fs, "/dir"))
+	})
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := gofs.NewFakeClock(start)
+	fs := gofs.NewMemoryFs(gofs.WithClock(clock))
+
+	require.NoError(t, fs.WriteFile("/old.log", []byte("old"), 0666))
+	clock.Advance(25 * time.Hour)
+	require.NoError(t, fs.WriteFile("/new.log", []byte("new"), 0666))
+
+	require.Equal(t, start, mtime(t, fs, "/old.log"))
+	require.Equal(t, start.Add(25*time.Hour), mtime(t, fs, "/new.log"))
+	require.Equal(t, start.Add(25*time.Hour), mtime(t, fs, "/"))
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	var rotate []string
+	for _, e := range entries {
+		info, err := e.Info()
+		require.NoError(t, err)
+		if clock.Now().Sub(info.ModTime()) > 24*time.Hour {
+			rotate = append(rotate, e.Name())
+		}
+	}
+	require.Equal(t, []string{"old.log"}, rotate)
+
+	clock.Set(start)
+	fp, err := fs.OpenFile("/new.log", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = fp.WriteString("!")
+	require.NoError(t, err)
+	require.NoError(t, fp.Close())
+	require.Equal(t, start, mtime(t, fs, "/new.log"))
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/myxo/gofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFaults(t *testing.T) {
+	const sector = 512
+	old := bytes.Repeat([]byte("a"), 4*sector)
+	overwritten := bytes.Repeat([]byte("b"), 4*sector)
+
+	// overwrite rewrites durable file content and syncs it
+	overwrite := func(t *testing.T, fs *gofs.InMemoryFS, name string, off int64, data []byte) {
+		fp, err := fs.OpenFile(name, os.O_RDWR, 0)
+		require.NoError(t, err)
+		_, err = fp.WriteAt(data, off)
+		require.NoError(t, err)
+		require.NoError(t, fp.Sync())
+		require.NoError(t, fp.Close())
+	}
+	newFs := func(t *testing.T, faults gofs.WriteFaults, seed int64) *gofs.InMemoryFS {
+		fs := gofs.NewMemoryFs()
+		fs.TrackDirtyPages()
+		writeSynced(t, fs, "/file", string(old))
+		writeSynced(t, fs, "/other", string(old))
+		syncDir(t, fs, "/")
+		fs.SetWriteFaults(faults, rand.New(rand.NewSource(seed)))
+		return fs
+	}
+	readFile := func(t *testing.T, fs *gofs.InMemoryFS, name string) []byte {
+		data, err := fs.ReadFile(name)
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("lost", func(t *testing.T) {
+		fs := newFs(t, gofs.WriteFaults{Lost: 1}, 1)
+		overwrite(t, fs, "/file", 0, overwritten)
+		require.Equal(t, overwritten, readFile(t, fs, "/file"))
+
+		fs.Crash(rand.New(rand.NewSource(1)))
+		require.Equal(t, old, readFile(t, fs, "/file"))
+	})
+
+	t.Run("torn", func(t *testing.T) {
+		prefixes := map[int]bool{}
+		for seed := int64(0); seed < 20; seed++ {
+			fs := newFs(t, gofs.WriteFaults{Torn: 1}, seed)
+			overwrite(t, fs, "/file", 0, overwritten)
+			fs.Crash(rand.New(rand.NewSource(seed)))
+
+			data := readFile(t, fs, "/file")
+			prefix := bytes.Count(data, []byte("b"))
+			require.Zero(t, prefix%sector)
+			require.Equal(t, overwritten[:prefix], data[:prefix])
+			require.Equal(t, old[prefix:], data[prefix:])
+			prefixes[prefix/sector] = true
+		}
+		require.Greater(t, len(prefixes), 1)
+		require.NotContains(t, prefixes, 4, "torn write is never complete")
+	})
+
+	t.Run("misdirected", func(t *testing.T) {
+		seenOther := false
+		for seed := int64(0); seed < 20; seed++ {
+			fs := newFs(t, gofs.WriteFaults{Misdirected: 1}, seed)
+			overwrite(t, fs, "/file", sector, bytes.Repeat([]byte("x"), sector))
+			fs.Crash(rand.New(rand.NewSource(seed)))
+
+			file, other := readFile(t, fs, "/file"), readFile(t, fs, "/other")
+			require.Equal(t, old[:sector], file[sector:2*sector])
+			require.Equal(t, sector, bytes.Count(file, []byte("x"))+bytes.Count(other, []byte("x")))
+			seenOther = seenOther || bytes.Contains(other, []byte("x"))
+		}
+		require.True(t, seenOther)
+	})
+
+	t.Run("default source", func(t *testing.T) {
+		fs := newFs(t, gofs.WriteFaults{}, 0)
+		fs.SetWriteFaults(gofs.WriteFaults{Lost: 1}, nil)
+		overwrite(t, fs, "/file", 0, overwritten)
+		fs.Crash(rand.New(rand.NewSource(1)))
+		require.Equal(t, old, readFile(t, fs, "/file"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		fs := gofs.NewMemoryFs(gofs.WithWriteFaults(gofs.WriteFaults{Lost: 1}, rand.New(rand.NewSource(1))))
+		fs.SetWriteFaults(gofs.WriteFaults{}, nil)
+		fs.TrackDirtyPages()
+		writeSynced(t, fs, "/file", string(old))
+		syncDir(t, fs, "/")
+		fs.Crash(rand.New(rand.NewSource(1)))
+		require.Equal(t, old, readFile(t, fs, "/file"))
+	})
+}
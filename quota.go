@@ -0,0 +1,193 @@
+package gofs
+
+import (
+	"syscall"
+)
+
+// quota limits directory subtree, like project quota in xfs. Every inode is charged to the quota of the
+// closest quota root above it, and to all enclosing quotas through parent. Counters are guarded by fs capMu.
+type quota struct {
+	parent     *quota // quota of directory containing quota root, nil if there is none
+	bytes      int64  // zero means unlimited
+	inodes     int64
+	usedBytes  int64
+	usedInodes int64
+}
+
+// DirQuota describes limits and usage of directory quota. Zero limit means unlimited.
+type DirQuota struct {
+	Bytes      int64
+	Inodes     int64
+	UsedBytes  int64
+	UsedInodes int64
+}
+
+// childQuota returns quota charged for new entries of directory
+func (m *memData) childQuota() *quota {
+	if m.subQuota != nil {
+		return m.subQuota
+	}
+	return m.quota
+}
+
+// SetQuota limits total size of file content and number of inodes inside dir (directory itself is not counted).
+// Zero means no limit. Once limit is reached, writes, truncates, file creation and renames into dir fail with
+// syscall.EDQUOT. Quotas may be nested, inode is charged to all of them. Content already in dir is charged to
+// new quota even if it exceeds limits. Hard links across quota boundary are not allowed, Link returns
+// syscall.EXDEV, and so does Rename of file with other links left behind.
+func (f *InMemoryFS) SetQuota(dir string, bytes, inodes int64) error {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(dir, true)
+	if err == nil && inode == nil {
+		err = syscall.ENOENT
+	}
+	if err == nil && !inode.isDir() {
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return MakeWrappedError("SetQuota", dir, err)
+	}
+
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	q := inode.subQuota
+	if q == nil {
+		q = &quota{parent: inode.quota}
+		q.usedBytes, q.usedInodes = subtreeUsage(inode, q.parent)
+		q.usedInodes-- // directory itself stays charged to enclosing quota
+		for _, child := range inode.children {
+			setSubtreeQuota(child, q.parent, q)
+		}
+		inode.subQuota = q
+	}
+	q.bytes = max(bytes, 0)
+	q.inodes = max(inodes, 0)
+	return nil
+}
+
+// Quota returns limits and usage of quota set on dir with SetQuota. If there is no quota,
+// it returns syscall.ESRCH like quotactl.
+func (f *InMemoryFS) Quota(dir string) (DirQuota, error) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	_, _, inode, err := f.lookup(dir, true)
+	if err == nil && inode == nil {
+		err = syscall.ENOENT
+	}
+	if err == nil && inode.subQuota == nil {
+		err = syscall.ESRCH
+	}
+	if err != nil {
+		return DirQuota{}, MakeWrappedError("Quota", dir, err)
+	}
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+	q := inode.subQuota
+	return DirQuota{Bytes: q.bytes, Inodes: q.inodes, UsedBytes: q.usedBytes, UsedInodes: q.usedInodes}, nil
+}
+
+// moveQuota charges inode with its subtree to quota to instead of current one, as needed on rename.
+// Quotas enclosing both old and new place keep their usage. With force limits are not checked, which is
+// needed to undo rename.
+func (f *InMemoryFS) moveQuota(inode *memData, to *quota, force bool) error {
+	f.capMu.Lock()
+	defer f.capMu.Unlock()
+
+	from := inode.quota
+	if !force && linkedOutside(inode, from) {
+		// like in Link, inode can't be charged to two quotas
+		return syscall.EXDEV
+	}
+	usedBytes, usedInodes := subtreeUsage(inode, from)
+	for q := to; q != nil && !q.encloses(from) && !force; q = q.parent {
+		if available(usedBytes, q.bytes, q.usedBytes) < usedBytes ||
+			available(usedInodes, q.inodes, q.usedInodes) < usedInodes {
+			return syscall.EDQUOT
+		}
+	}
+	for q := to; q != nil && !q.encloses(from); q = q.parent {
+		q.usedBytes += usedBytes
+		q.usedInodes += usedInodes
+	}
+	for q := from; q != nil && !q.encloses(to); q = q.parent {
+		q.usedBytes -= usedBytes
+		q.usedInodes -= usedInodes
+	}
+	setSubtreeQuota(inode, from, to)
+	return nil
+}
+
+// encloses reports if q is other or one of its parents
+func (q *quota) encloses(other *quota) bool {
+	for ; other != nil; other = other.parent {
+		if other == q {
+			return true
+		}
+	}
+	return false
+}
+
+// subtreeUsage returns usage of inode and its subtree charged to quota q. Nested quotas are accounted as
+// a whole. Should be called with locked capMu.
+func subtreeUsage(inode *memData, q *quota) (usedBytes, usedInodes int64) {
+	seen := map[*memData]struct{}{}
+	walkQuotaSubtree(inode, q, func(inode *memData) {
+		if _, ok := seen[inode]; ok {
+			return // hard link
+		}
+		seen[inode] = struct{}{}
+		usedBytes += inode.charged
+		usedInodes++
+	}, func(nested *quota) {
+		usedBytes += nested.usedBytes
+		usedInodes += nested.usedInodes
+	})
+	return usedBytes, usedInodes
+}
+
+// linkedOutside reports if some file of inode subtree charged to q has hard links outside of the subtree.
+// Should be called with locked capMu.
+func linkedOutside(inode *memData, q *quota) bool {
+	links := map[*memData]int{}
+	walkQuotaSubtree(inode, q, func(inode *memData) {
+		links[inode]++
+	}, func(*quota) {})
+	for inode, n := range links {
+		if !inode.isDir() && n < inode.nlink {
+			return true
+		}
+	}
+	return false
+}
+
+// setSubtreeQuota moves inode and its subtree from quota q to other. Should be called with locked capMu.
+func setSubtreeQuota(inode *memData, q, other *quota) {
+	walkQuotaSubtree(inode, q, func(inode *memData) {
+		inode.quota = other
+	}, func(nested *quota) {
+		nested.parent = other
+	})
+}
+
+// walkQuotaSubtree calls fn for inodes charged directly to q, and nestedFn for quotas nested in q
+func walkQuotaSubtree(inode *memData, q *quota, fn func(*memData), nestedFn func(*quota)) {
+	if inode.quota == q {
+		fn(inode)
+	}
+	if inode.subQuota != nil {
+		if inode.subQuota.parent == q {
+			nestedFn(inode.subQuota)
+		}
+		return
+	}
+	for _, child := range inode.children {
+		walkQuotaSubtree(child, q, fn, nestedFn)
+	}
+}
@@ -0,0 +1,77 @@
+package gofs
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// ShortIOSchedule decides how many of n requested bytes single read or write transfers. Result is clamped
+// to [1, n], it's not called for single byte transfers. In thread safe mode it should be safe for concurrent
+// use. See RandomShortIO and ScriptedShortIO.
+type ShortIOSchedule func(n int) int
+
+type shortIO struct {
+	reads  ShortIOSchedule
+	writes ShortIOSchedule
+}
+
+// WithShortIO makes Read and Write of files transfer less bytes than asked with nil error, according to
+// schedules. nil schedule means full transfers. See SetShortIO.
+func WithShortIO(reads, writes ShortIOSchedule) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.SetShortIO(reads, writes)
+	}
+}
+
+// SetShortIO changes short read and write schedules, see WithShortIO. Short reads happen with pipes and
+// sockets, short writes with nil error are never returned by os.File, but code ignoring n from Write will
+// lose data with them. Like in stdlib, ReadAt, WriteAt, ReadFrom and WriteFile retry until all bytes are
+// transferred, so they are never short.
+func (f *InMemoryFS) SetShortIO(reads, writes ShortIOSchedule) {
+	if reads == nil && writes == nil {
+		f.shortIO.Store(nil)
+		return
+	}
+	f.shortIO.Store(&shortIO{reads: reads, writes: writes})
+}
+
+// shortLen applies schedule to length of single read or write
+func shortLen(schedule ShortIOSchedule, n int) int {
+	if schedule == nil || n <= 1 {
+		return n
+	}
+	return min(max(schedule(n), 1), n)
+}
+
+// RandomShortIO makes transfers short with given probability, length of short transfer is uniformly
+// distributed.
+func RandomShortIO(seedRand *rand.Rand, probability float64) ShortIOSchedule {
+	var mu sync.Mutex
+	return func(n int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if seedRand.Float64() >= probability {
+			return n
+		}
+		return 1 + seedRand.Intn(n-1)
+	}
+}
+
+// ScriptedShortIO makes transfers in order take no more than given lengths, non positive length means
+// full transfer. After the script ends, transfers are full.
+func ScriptedShortIO(lengths ...int) ShortIOSchedule {
+	var mu sync.Mutex
+	return func(n int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(lengths) == 0 {
+			return n
+		}
+		l := lengths[0]
+		lengths = lengths[1:]
+		if l <= 0 {
+			return n
+		}
+		return l
+	}
+}
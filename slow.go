@@ -0,0 +1,433 @@
+package gofs
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// Delay is a distribution of operation latency, it's sampled with SlowFS random source. See ConstantDelay,
+// UniformDelay and LongTailDelay.
+type Delay func(r *rand.Rand) time.Duration
+
+// ConstantDelay always returns d
+func ConstantDelay(d time.Duration) Delay {
+	return func(*rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// UniformDelay returns delay uniformly distributed in [lo, hi)
+func UniformDelay(lo, hi time.Duration) Delay {
+	return func(r *rand.Rand) time.Duration {
+		if hi <= lo {
+			return lo
+		}
+		return lo + time.Duration(r.Int63n(int64(hi-lo)))
+	}
+}
+
+// LongTailDelay returns delay with Pareto distribution: it's never less than lo, and probability to exceed
+// lo*x is x^(-alpha), so the smaller alpha is, the heavier is the tail. Delay is capped at hi.
+func LongTailDelay(lo, hi time.Duration, alpha float64) Delay {
+	return func(r *rand.Rand) time.Duration {
+		d := float64(lo) / math.Pow(1-r.Float64(), 1/alpha)
+		return time.Duration(min(d, float64(hi)))
+	}
+}
+
+// PerfModel describes how slow SlowFS is. Zero model adds no delays.
+type PerfModel struct {
+	// Latency is delay of each call by operation name. Names are the same as for FaultRule.Op, Latency[""]
+	// applies to operations, which are not listed.
+	Latency map[string]Delay
+	// ReadBandwidth and WriteBandwidth limit throughput of reads and writes in bytes per second. Limit is
+	// shared by all files, so concurrent transfers wait for each other. Zero means unlimited.
+	ReadBandwidth  int64
+	WriteBandwidth int64
+	// SyncBandwidth makes Sync of file take time to flush bytes written to it since the last Sync, in
+	// bytes per second. Zero means unlimited.
+	SyncBandwidth int64
+}
+
+// SlowFS wraps any FS, including OsFs, and delays its and its files operations according to performance
+// model. Latency is added before operation, transfer time after it, since it depends on bytes transferred.
+// SlowFS is safe for concurrent use.
+type SlowFS struct {
+	fs    FS
+	clock *FakeClock
+	mu    sync.Mutex // guards fields below
+	model PerfModel
+	rand  *rand.Rand
+	busy  [3]time.Time // time, when device finishes already requested transfers in each direction
+}
+
+var _ FS = &SlowFS{}
+
+type transferDir int
+
+const (
+	transferRead transferDir = iota
+	transferWrite
+	transferSync
+)
+
+// NewSlowFS creates performance model wrapper over fs. seedRand is used to sample delays, if it's nil, source
+// with zero seed is used. If clock is nil, SlowFS really sleeps, otherwise it advances the clock instead and
+// never blocks. Share the clock with InMemoryFS (see WithClock) to make timestamps agree with delays.
+func NewSlowFS(fs FS, model PerfModel, seedRand *rand.Rand, clock *FakeClock) *SlowFS {
+	if seedRand == nil {
+		seedRand = rand.New(rand.NewSource(0))
+	}
+	return &SlowFS{fs: fs, clock: clock, model: model, rand: seedRand}
+}
+
+// SetModel changes performance model, transfers already requested are not affected
+func (f *SlowFS) SetModel(model PerfModel) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.model = model
+}
+
+func (f *SlowFS) now() time.Time {
+	if f.clock != nil {
+		return f.clock.Now()
+	}
+	return time.Now()
+}
+
+// sleep waits until t, or moves fake clock to it
+func (f *SlowFS) sleep(t time.Time) {
+	if f.clock != nil {
+		f.clock.advanceTo(t)
+		return
+	}
+	time.Sleep(time.Until(t))
+}
+
+// latency waits for latency of op
+func (f *SlowFS) latency(op string) {
+	f.mu.Lock()
+	delay, ok := f.model.Latency[op]
+	if !ok {
+		delay = f.model.Latency[""]
+	}
+	var d time.Duration
+	if delay != nil {
+		d = delay(f.rand)
+	}
+	f.mu.Unlock()
+
+	if d > 0 {
+		f.sleep(f.now().Add(d))
+	}
+}
+
+// transfer waits until n bytes are transferred in direction dir, after transfers requested earlier
+func (f *SlowFS) transfer(dir transferDir, n int64) {
+	f.mu.Lock()
+	bandwidth := [...]int64{f.model.ReadBandwidth, f.model.WriteBandwidth, f.model.SyncBandwidth}[dir]
+	if bandwidth <= 0 || n <= 0 {
+		f.mu.Unlock()
+		return
+	}
+	start := f.now()
+	if f.busy[dir].After(start) {
+		start = f.busy[dir]
+	}
+	end := start.Add(time.Duration(float64(n) / float64(bandwidth) * float64(time.Second)))
+	f.busy[dir] = end
+	f.mu.Unlock()
+
+	f.sleep(end)
+}
+
+func (f *SlowFS) wrapFile(fp *File, err error) (*File, error) {
+	if err != nil {
+		return fp, err
+	}
+	return &File{wrapped: &slowFile{fs: f, file: fp}}, nil
+}
+
+func (f *SlowFS) Create(name string) (*File, error) {
+	f.latency("Create")
+	return f.wrapFile(f.fs.Create(name))
+}
+
+func (f *SlowFS) CreateTemp(dir, pattern string) (*File, error) {
+	f.latency("CreateTemp")
+	return f.wrapFile(f.fs.CreateTemp(dir, pattern))
+}
+
+func (f *SlowFS) Open(name string) (*File, error) {
+	f.latency("Open")
+	return f.wrapFile(f.fs.Open(name))
+}
+
+func (f *SlowFS) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	f.latency("OpenFile")
+	return f.wrapFile(f.fs.OpenFile(name, flag, perm))
+}
+
+func (f *SlowFS) Chdir(dir string) error {
+	f.latency("Chdir")
+	return f.fs.Chdir(dir)
+}
+
+func (f *SlowFS) Chmod(name string, mode os.FileMode) error {
+	f.latency("Chmod")
+	return f.fs.Chmod(name, mode)
+}
+
+func (f *SlowFS) Chown(name string, uid, gid int) error {
+	f.latency("Chown")
+	return f.fs.Chown(name, uid, gid)
+}
+
+func (f *SlowFS) Lchown(name string, uid, gid int) error {
+	f.latency("Lchown")
+	return f.fs.Lchown(name, uid, gid)
+}
+
+func (f *SlowFS) Mkdir(name string, perm os.FileMode) error {
+	f.latency("Mkdir")
+	return f.fs.Mkdir(name, perm)
+}
+
+func (f *SlowFS) MkdirAll(path string, perm os.FileMode) error {
+	f.latency("MkdirAll")
+	return f.fs.MkdirAll(path, perm)
+}
+
+func (f *SlowFS) MkdirTemp(dir, pattern string) (string, error) {
+	f.latency("MkdirTemp")
+	return f.fs.MkdirTemp(dir, pattern)
+}
+
+func (f *SlowFS) TempDir() string {
+	return f.fs.TempDir()
+}
+
+func (f *SlowFS) ReadFile(name string) ([]byte, error) {
+	f.latency("ReadFile")
+	data, err := f.fs.ReadFile(name)
+	f.transfer(transferRead, int64(len(data)))
+	return data, err
+}
+
+func (f *SlowFS) Readlink(name string) (string, error) {
+	f.latency("Readlink")
+	return f.fs.Readlink(name)
+}
+
+func (f *SlowFS) ReadDir(name string) ([]os.DirEntry, error) {
+	f.latency("ReadDir")
+	return f.fs.ReadDir(name)
+}
+
+func (f *SlowFS) Remove(name string) error {
+	f.latency("Remove")
+	return f.fs.Remove(name)
+}
+
+func (f *SlowFS) RemoveAll(path string) error {
+	f.latency("RemoveAll")
+	return f.fs.RemoveAll(path)
+}
+
+func (f *SlowFS) Rename(oldpath, newpath string) error {
+	f.latency("Rename")
+	return f.fs.Rename(oldpath, newpath)
+}
+
+func (f *SlowFS) Truncate(name string, size int64) error {
+	f.latency("Truncate")
+	return f.fs.Truncate(name, size)
+}
+
+func (f *SlowFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f.latency("WriteFile")
+	err := f.fs.WriteFile(name, data, perm)
+	f.transfer(transferWrite, int64(len(data)))
+	return err
+}
+
+func (f *SlowFS) Stat(name string) (os.FileInfo, error) {
+	f.latency("Stat")
+	return f.fs.Stat(name)
+}
+
+func (f *SlowFS) Lstat(name string) (os.FileInfo, error) {
+	f.latency("Lstat")
+	return f.fs.Lstat(name)
+}
+
+func (f *SlowFS) Symlink(oldname, newname string) error {
+	f.latency("Symlink")
+	return f.fs.Symlink(oldname, newname)
+}
+
+func (f *SlowFS) Link(oldname, newname string) error {
+	f.latency("Link")
+	return f.fs.Link(oldname, newname)
+}
+
+func (f *SlowFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	f.latency("Chtimes")
+	return f.fs.Chtimes(name, atime, mtime)
+}
+
+func (f *SlowFS) Statfs(path string) (FsStat, error) {
+	f.latency("Statfs")
+	return f.fs.Statfs(path)
+}
+
+// slowFile is a file opened with SlowFS
+type slowFile struct {
+	fs      *SlowFS
+	file    *File
+	mu      sync.Mutex
+	written int64 // bytes written since the last Sync
+}
+
+func (f *slowFile) wrote(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.written += int64(n)
+}
+
+func (f *slowFile) Fd() uintptr {
+	return f.file.Fd()
+}
+
+func (f *slowFile) Chdir() error {
+	f.fs.latency("Chdir")
+	return f.file.Chdir()
+}
+
+func (f *slowFile) Chmod(mode os.FileMode) error {
+	f.fs.latency("Chmod")
+	return f.file.Chmod(mode)
+}
+
+func (f *slowFile) Chown(uid, gid int) error {
+	f.fs.latency("Chown")
+	return f.file.Chown(uid, gid)
+}
+
+func (f *slowFile) Close() error {
+	f.fs.latency("Close")
+	return f.file.Close()
+}
+
+func (f *slowFile) Name() string {
+	return f.file.Name()
+}
+
+func (f *slowFile) Read(b []byte) (n int, err error) {
+	f.fs.latency("Read")
+	n, err = f.file.Read(b)
+	f.fs.transfer(transferRead, int64(n))
+	return n, err
+}
+
+func (f *slowFile) ReadAt(b []byte, off int64) (n int, err error) {
+	f.fs.latency("ReadAt")
+	n, err = f.file.ReadAt(b, off)
+	f.fs.transfer(transferRead, int64(n))
+	return n, err
+}
+
+func (f *slowFile) ReadDir(n int) ([]os.DirEntry, error) {
+	f.fs.latency("ReadDir")
+	return f.file.ReadDir(n)
+}
+
+// ReadFrom goes through Write, so write latency and bandwidth apply to it
+func (f *slowFile) ReadFrom(r io.Reader) (n int64, err error) {
+	return io.Copy(slowFileWriter{f}, r)
+}
+
+// slowFileWriter hides ReadFrom of slowFile from io.Copy
+type slowFileWriter struct {
+	f *slowFile
+}
+
+func (w slowFileWriter) Write(b []byte) (n int, err error) {
+	return w.f.Write(b)
+}
+
+func (f *slowFile) Readdir(n int) ([]os.FileInfo, error) {
+	f.fs.latency("Readdir")
+	return f.file.Readdir(n)
+}
+
+func (f *slowFile) Readdirnames(n int) (names []string, err error) {
+	f.fs.latency("Readdirnames")
+	return f.file.Readdirnames(n)
+}
+
+func (f *slowFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.fs.latency("Seek")
+	return f.file.Seek(offset, whence)
+}
+
+func (f *slowFile) Stat() (os.FileInfo, error) {
+	f.fs.latency("Stat")
+	return f.file.Stat()
+}
+
+func (f *slowFile) Sync() error {
+	f.fs.latency("Sync")
+	f.mu.Lock()
+	written := f.written
+	f.written = 0
+	f.mu.Unlock()
+	err := f.file.Sync()
+	f.fs.transfer(transferSync, written)
+	return err
+}
+
+func (f *slowFile) Truncate(size int64) error {
+	f.fs.latency("Truncate")
+	return f.file.Truncate(size)
+}
+
+func (f *slowFile) Write(b []byte) (n int, err error) {
+	f.fs.latency("Write")
+	n, err = f.file.Write(b)
+	f.wrote(n)
+	f.fs.transfer(transferWrite, int64(n))
+	return n, err
+}
+
+func (f *slowFile) WriteAt(b []byte, off int64) (n int, err error) {
+	f.fs.latency("WriteAt")
+	n, err = f.file.WriteAt(b, off)
+	f.wrote(n)
+	f.fs.transfer(transferWrite, int64(n))
+	return n, err
+}
+
+func (f *slowFile) WriteString(s string) (n int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *slowFile) IsFake() bool {
+	return f.file.IsFake()
+}
+
+func (f *slowFile) SetDeadline(t time.Time) error {
+	return f.file.SetDeadline(t)
+}
+
+func (f *slowFile) SetReadDeadline(t time.Time) error {
+	return f.file.SetReadDeadline(t)
+}
+
+func (f *slowFile) SetWriteDeadline(t time.Time) error {
+	return f.file.SetWriteDeadline(t)
+}
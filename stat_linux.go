@@ -0,0 +1,13 @@
+package gofs
+
+import "syscall"
+
+func setSysTimes(st *syscall.Stat_t, inode *memData) {
+	st.Atim = syscall.NsecToTimespec(inode.atime.UnixNano())
+	st.Mtim = syscall.NsecToTimespec(inode.mtime.UnixNano())
+	st.Ctim = syscall.NsecToTimespec(inode.ctime.UnixNano())
+}
+
+func blockSize(st *syscall.Statfs_t) uint64 {
+	return uint64(st.Frsize)
+}
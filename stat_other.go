@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package gofs
+
+import "errors"
+
+func newSysStat(inode *memData) any {
+	return nil
+}
+
+func statfs(path string) (FsStat, error) {
+	return FsStat{}, MakeWrappedError("statfs", path, errors.ErrUnsupported)
+}
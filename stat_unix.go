@@ -0,0 +1,68 @@
+//go:build linux || darwin
+
+package gofs
+
+import (
+	"os"
+	"syscall"
+)
+
+// setNum is needed since Stat_t field types differ between platforms and architectures
+func setNum[T ~int32 | ~int64 | ~uint16 | ~uint32 | ~uint64](dst *T, v int64) {
+	*dst = T(v)
+}
+
+func newSysStat(inode *memData) *syscall.Stat_t {
+	var st syscall.Stat_t
+	setNum(&st.Ino, int64(inode.ino))
+	setNum(&st.Nlink, int64(inode.nlink))
+	setNum(&st.Mode, int64(unixMode(inode)))
+	setNum(&st.Size, inode.Size())
+	setNum(&st.Uid, int64(inode.uid))
+	setNum(&st.Gid, int64(inode.gid))
+	setSysTimes(&st, inode)
+	return &st
+}
+
+func unixMode(inode *memData) uint32 {
+	mode := uint32(inode.mode.Perm())
+	if inode.mode&os.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if inode.mode&os.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if inode.mode&os.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+	switch inode.mode.Type() {
+	case os.ModeDir:
+		mode |= syscall.S_IFDIR
+	case os.ModeSymlink:
+		mode |= syscall.S_IFLNK
+	case os.ModeNamedPipe:
+		mode |= syscall.S_IFIFO
+	case os.ModeSocket:
+		mode |= syscall.S_IFSOCK
+	case os.ModeDevice | os.ModeCharDevice:
+		mode |= syscall.S_IFCHR
+	case os.ModeDevice:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	return mode
+}
+
+func statfs(path string) (FsStat, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return FsStat{}, MakeWrappedError("statfs", path, err)
+	}
+	return FsStat{
+		TotalBytes:  st.Blocks * blockSize(&st),
+		FreeBytes:   st.Bavail * blockSize(&st),
+		TotalInodes: st.Files,
+		FreeInodes:  st.Ffree,
+	}, nil
+}
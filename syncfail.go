@@ -0,0 +1,63 @@
+package gofs
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// SyncFailureMode decides what happens with data, which failed Sync didn't make durable
+type SyncFailureMode int
+
+const (
+	// KeepDirtyOnSyncFailure leaves data dirty, so retried Sync may make it durable
+	KeepDirtyOnSyncFailure SyncFailureMode = iota
+	// DropDirtyOnSyncFailure marks data clean, like linux does ("fsyncgate"). Data stays readable until
+	// Crash, which loses it, and retried Sync succeeds without writing it.
+	DropDirtyOnSyncFailure
+)
+
+type syncFailure struct {
+	pattern string
+	count   int
+	mode    SyncFailureMode
+}
+
+// SetSyncFailure makes next count calls of Sync on files with names matching pattern (see filepath.Match)
+// fail with syscall.EIO. Name is the one file was opened with, empty pattern matches any file. Failed Sync
+// of directory makes no namespace changes durable regardless of mode. Non positive count removes failure.
+func (f *InMemoryFS) SetSyncFailure(pattern string, count int, mode SyncFailureMode) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	if count <= 0 {
+		f.syncFailure = nil
+		return
+	}
+	f.syncFailure = &syncFailure{pattern: pattern, count: count, mode: mode}
+}
+
+// syncFails reports if Sync of file name should fail, and how. Should be called with locked fs mutex.
+func (f *InMemoryFS) syncFails(name string) (SyncFailureMode, bool) {
+	sf := f.syncFailure
+	if sf == nil {
+		return 0, false
+	}
+	if ok, _ := filepath.Match(sf.pattern, name); !ok && sf.pattern != "" {
+		return 0, false
+	}
+	sf.count--
+	if sf.count == 0 {
+		f.syncFailure = nil
+	}
+	return sf.mode, true
+}
+
+// failSync drops dirty pages if mode says so and returns Sync error. Should be called with locked mutex.
+func (f *FakeFile) failSync(mode SyncFailureMode) error {
+	if mode == DropDirtyOnSyncFailure {
+		f.data.dirtyPages = f.data.dirtyPages[:0]
+	}
+	return MakeWrappedError("Sync", f.name, syscall.EIO)
+}
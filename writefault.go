@@ -0,0 +1,107 @@
+package gofs
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+)
+
+// WriteFaults are probabilities of storage failures of a single write (one Write or WriteAt call). They
+// happen when Sync moves data to disk: Sync reports success, but disk content, which is seen after Crash,
+// differs. Write fails at most in one way, so the sum should not exceed 1. See SetWriteFaults.
+type WriteFaults struct {
+	// Torn write persists only a prefix of its sectors, possibly empty
+	Torn float64
+	// Lost write doesn't reach the disk at all
+	Lost float64
+	// Misdirected write lands at a wrong sector of the same or another file, while its place keeps old data
+	Misdirected float64
+}
+
+type writeFaults struct {
+	WriteFaults
+	rand *rand.Rand
+}
+
+// WithWriteFaults enables storage failures on Sync, see SetWriteFaults
+func WithWriteFaults(faults WriteFaults, seedRand *rand.Rand) MemoryFsOption {
+	return func(f *InMemoryFS) {
+		f.SetWriteFaults(faults, seedRand)
+	}
+}
+
+// SetWriteFaults enables storage failures on Sync, seedRand makes all random decisions. If it's nil, source
+// with zero seed is used. Faults need TrackDirtyPages, since only written data may fail. Zero faults disable them.
+func (f *InMemoryFS) SetWriteFaults(faults WriteFaults, seedRand *rand.Rand) {
+	if f.threadSafeMode {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	if faults == (WriteFaults{}) {
+		f.writeFaults = nil
+		return
+	}
+	if seedRand == nil {
+		seedRand = rand.New(rand.NewSource(0))
+	}
+	f.writeFaults = &writeFaults{WriteFaults: faults, rand: seedRand}
+}
+
+// persist moves written range of content to disk, unless write fault happens. Should be called with locked
+// fs mutex and mutex.
+func (m *memData) persist(from, to int64) {
+	wf := m.fs.writeFaults
+	if wf == nil || from >= to {
+		copy(m.durable[from:to], m.buff[from:to])
+		return
+	}
+	p := wf.rand.Float64()
+	switch {
+	case p < wf.Lost:
+	case p < wf.Lost+wf.Torn:
+		first := from / sectorSize
+		sectors := (to-1)/sectorSize - first + 1
+		end := (first + wf.rand.Int63n(sectors)) * sectorSize
+		if end > from {
+			copy(m.durable[from:end], m.buff[from:end])
+		}
+	case p < wf.Lost+wf.Torn+wf.Misdirected:
+		m.misdirect(from, to, wf.rand)
+	default:
+		copy(m.durable[from:to], m.buff[from:to])
+	}
+}
+
+// misdirect writes range of content to random sector of some file on disk, other than the right one
+func (m *memData) misdirect(from, to int64, r *rand.Rand) {
+	var files []*memData
+	m.fs.forEachInode(func(inode *memData) {
+		if inode.mode.IsRegular() && len(inode.durable) > 0 {
+			files = append(files, inode)
+		}
+	})
+	if len(files) == 0 {
+		return
+	}
+	// map iteration order is random, but decisions should be reproducible
+	slices.SortFunc(files, func(a, b *memData) int {
+		return cmp.Compare(a.ino, b.ino)
+	})
+	target := files[r.Intn(len(files))]
+	size := int64(len(target.durable))
+	sectors := (size + sectorSize - 1) / sectorSize
+	off := r.Int63n(sectors) * sectorSize
+	if target == m && off == from/sectorSize*sectorSize {
+		off = (off + sectorSize) % (sectors * sectorSize)
+		if off == from/sectorSize*sectorSize {
+			return // nowhere to misdirect, write is lost
+		}
+	}
+	if target != m && target.threadSafeMode {
+		// it's safe to lock second inode, since other holders of two inode mutexes take fs mutex first
+		target.mu.Lock()
+		defer target.mu.Unlock()
+	}
+	copy(target.durable[off:], m.buff[from:to])
+}